@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/commands"
 	"github.com/chalkan3/slothctl/pkg/config"
@@ -21,6 +24,10 @@ var rootCmd = &cobra.Command{
 func main() {
 	commands.RegisterCommands(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		log.Fatal("Error executing slothctl", "error", err)
 	}
 }
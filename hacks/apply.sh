@@ -5,8 +5,8 @@ set -euo pipefail
 echo "Building slothctl binary..."
 go build -o slothctl ./cmd/slothctl
 
-echo "Initializing Incus (non-interactively) with preseed file..."
-cat /home/igor/.chalkan3/slothctl/hacks/incus-preseed.yaml | sudo incus admin init --preseed || true # || true to ignore if already initialized
+echo "Initializing Incus from the slothctl preseed..."
+./slothctl configure init control-plane --only-phase incus
 
 echo "Creating Arch Linux container 'slothctl-arch-test'..."
 sudo incus launch images:archlinux/current slothctl-arch-test
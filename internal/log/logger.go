@@ -42,7 +42,8 @@ func NewLogger(opts *Options) Logger {
 		handler = NewTextHandler(opts.Output, handlerOpts) // Default to text
 	}
 
-	return &logger{sl: slog.New(handler)}
+	// Secrets registered with RegisterSecret never reach the output.
+	return &logger{sl: slog.New(NewRedactingHandler(handler))}
 }
 
 func (l *logger) Debug(msg string, args ...any) {
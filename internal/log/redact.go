@@ -0,0 +1,123 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces secret values in log output.
+const RedactedValue = "(sensitive)"
+
+// minSecretLength is the length below which values are not treated as secrets.
+// Redacting very short values would mangle unrelated log output.
+const minSecretLength = 4
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string // Sorted longest first, so overlapping secrets are fully replaced
+)
+
+// RegisterSecret marks a value as secret. Every log record written afterwards
+// has the value replaced with RedactedValue, wherever it appears.
+func RegisterSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// IsSecret reports whether a value was registered as secret.
+func IsSecret(value string) bool {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, s := range secrets {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces every registered secret in s with RedactedValue.
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, RedactedValue)
+		}
+	}
+	return s
+}
+
+// redactingHandler is a slog.Handler that removes registered secrets from the
+// message and attributes of every record before passing it on.
+type redactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps a handler so that registered secrets never reach it.
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	return &redactingHandler{next: next}
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, redactAttr(attr))
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr removes secrets from an attribute. Values that are not strings,
+// such as maps of change details, are checked in their printed form and
+// replaced by the redacted text if they contain a secret.
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, 0, len(group))
+		for _, a := range group {
+			redacted = append(redacted, redactAttr(a))
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		printed := fmt.Sprintf("%v", value.Any())
+		if redacted := Redact(printed); redacted != printed {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	return attr
+}
@@ -1,8 +1,14 @@
 package bootstrap
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"sync" // For WaitGroup
+	"time"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
@@ -12,72 +18,335 @@ import (
 	"github.com/chalkan3/slothctl/pkg/bootstrap/vault"
 )
 
+// Options control a control plane bootstrap run.
+type Options struct {
+	DryRun           bool
+	SaltUserPassword string // Password of the dedicated Salt user; no user is created if empty
+	VaultInit        vault.InitOptions
+	IncusPreseed     *incus.Preseed // Networks, storage pools and profiles Incus is initialized with
+	Salt             salt.Config    // Salt master and minion configuration
+	Resume           bool           // Skip phases that already completed with the same inputs
+	FromPhase        string         // Run this phase and every phase after it
+	OnlyPhase        string         // Run only this phase
+}
+
+// incusPreseed returns the Incus preseed to apply, or the default one.
+func (o Options) incusPreseed() *incus.Preseed {
+	if o.IncusPreseed == nil {
+		return incus.DefaultPreseed()
+	}
+	return o.IncusPreseed
+}
+
+// Phase is a named step of the control plane bootstrap. A phase starts once
+// the phases it depends on have completed, and independent phases run in
+// parallel.
+type Phase struct {
+	Name      string
+	DependsOn []string
+	// Inputs returns what the phase's result depends on. A completed phase is
+	// only skipped on resume if its inputs are unchanged.
+	Inputs func(opts Options) []string
+	// Run performs the phase and returns the outputs recorded in its checkpoint.
+	Run func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error)
+}
+
+// InputsHash returns the hash of the phase's inputs recorded in its checkpoint.
+func (p Phase) InputsHash(opts Options) string {
+	sum := sha256.New()
+	sum.Write([]byte(p.Name))
+	for _, input := range p.Inputs(opts) {
+		sum.Write([]byte{0})
+		sum.Write([]byte(input))
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// Phases are the phases of the control plane bootstrap, in order.
+var Phases = []Phase{
+	{
+		Name:   "vault",
+		Inputs: func(Options) []string { return []string{vault.PackageName, vault.ConfigContent()} },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := vault.InstallAndConfigureVault(ctx, goroutineName, opts.DryRun); err != nil {
+				return nil, err
+			}
+			return map[string]string{"config": vault.ConfigPath, "listener": vault.ListenerAddress}, nil
+		},
+	},
+	{
+		Name: "incus",
+		Inputs: func(opts Options) []string {
+			preseed, _ := opts.incusPreseed().Render()
+			return []string{incus.PackageName, string(preseed)}
+		},
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := incus.InstallAndConfigureIncus(ctx, goroutineName, opts.DryRun, opts.incusPreseed()); err != nil {
+				return nil, err
+			}
+			return map[string]string{"service": incus.ServiceName}, nil
+		},
+	},
+	{
+		Name:   "salt-packages",
+		Inputs: func(Options) []string { return salt.Packages(true) },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := common.InstallPackages(ctx, goroutineName, opts.DryRun, salt.Packages(true)); err != nil {
+				return nil, fmt.Errorf("failed to install Salt packages: %w", err)
+			}
+			return map[string]string{"packages": strings.Join(salt.Packages(true), ",")}, nil
+		},
+	},
+	{
+		Name: "salt-user",
+		// Only whether a user is created: the checkpoint must not depend on
+		// the password, so a changed password is applied with --only-phase.
+		Inputs: func(opts Options) []string { return []string{fmt.Sprint(opts.SaltUserPassword != "")} },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if opts.SaltUserPassword == "" {
+				log.Info(fmt.Sprintf("%s: No Salt user password given, skipping the dedicated Salt user.", goroutineName))
+				return nil, nil
+			}
+			username, err := salt.CreateSaltUser(ctx, goroutineName, opts.DryRun, opts.SaltUserPassword)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"username": username}, nil
+		},
+	},
+	{
+		Name: "salt-tree",
+		Inputs: func(opts Options) []string {
+			return []string{salt.TreeDir, fmt.Sprint(salt.ServesTree(opts.Salt)), salt.TreeHash()}
+		},
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if !salt.ServesTree(opts.Salt) {
+				log.Info(fmt.Sprintf("%s: The Salt master does not serve %s, skipping the salt tree.", goroutineName, salt.TreeDir))
+				return nil, nil
+			}
+			if err := salt.InstallTree(ctx, goroutineName, opts.DryRun); err != nil {
+				return nil, err
+			}
+			return map[string]string{"dir": salt.TreeDir}, nil
+		},
+	},
+	{
+		Name:      "salt-master",
+		DependsOn: []string{"salt-packages", "salt-user", "salt-tree"},
+		Inputs:    func(opts Options) []string { return []string{salt.MasterConfigContent(opts.Salt)} },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := salt.ConfigureMaster(ctx, goroutineName, opts.DryRun, opts.Salt); err != nil {
+				return nil, err
+			}
+			return map[string]string{"config": salt.MasterConfigPath}, nil
+		},
+	},
+	{
+		Name:      "salt-minion",
+		DependsOn: []string{"salt-master"},
+		Inputs:    func(opts Options) []string { return []string{salt.MinionConfigContent(opts.Salt)} },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := salt.ConfigureMinion(ctx, goroutineName, opts.DryRun, opts.Salt); err != nil {
+				return nil, err
+			}
+			return map[string]string{"config": salt.MinionConfigPath}, nil
+		},
+	},
+	{
+		Name:   "pass",
+		Inputs: func(Options) []string { return []string{pass.StoreDir()} },
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			if err := pass.InstallAndConfigurePass(ctx, goroutineName, opts.DryRun); err != nil {
+				return nil, err
+			}
+			return map[string]string{"store": pass.StoreDir()}, nil
+		},
+	},
+	{
+		Name:      "vault-init",
+		DependsOn: []string{"vault", "pass"},
+		Inputs: func(opts Options) []string {
+			return []string{fmt.Sprint(opts.VaultInit.SecretShares), fmt.Sprint(opts.VaultInit.SecretThreshold)}
+		},
+		Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+			// The keys exist only in Vault's response, so make sure they can be stored first.
+			if !opts.DryRun {
+				if err := pass.Ready(); err != nil {
+					return nil, err
+				}
+			}
+			if err := vault.Initialize(ctx, goroutineName, opts.DryRun, vault.DefaultAddress, opts.VaultInit, pass.Store{}); err != nil {
+				return nil, err
+			}
+			return map[string]string{"address": vault.DefaultAddress, "root_token": vault.RootTokenSecret}, nil
+		},
+	},
+}
+
+// PhaseNames returns the names of the bootstrap phases, in order.
+func PhaseNames() []string {
+	names := make([]string, len(Phases))
+	for i, phase := range Phases {
+		names[i] = phase.Name
+	}
+	return names
+}
+
+// errDependencyFailed marks a phase that was not run because a phase it
+// depends on did not complete.
+var errDependencyFailed = errors.New("dependency did not complete")
+
+// selectPhases returns the phases to run for opts. Every phase a selected
+// phase depends on must either be selected too or have completed in an
+// earlier run.
+func selectPhases(opts Options, checkpoints map[string]Checkpoint) ([]Phase, error) {
+	if opts.FromPhase != "" && opts.OnlyPhase != "" {
+		return nil, fmt.Errorf("--from-phase and --only-phase cannot be combined")
+	}
+	start, end := 0, len(Phases)
+	for _, name := range []string{opts.FromPhase, opts.OnlyPhase} {
+		if name == "" {
+			continue
+		}
+		index := -1
+		for i, phase := range Phases {
+			if phase.Name == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("unknown bootstrap phase %q (phases: %s)", name, strings.Join(PhaseNames(), ", "))
+		}
+		start = index
+		if name == opts.OnlyPhase {
+			end = index + 1
+		}
+	}
+
+	selected := Phases[start:end]
+	names := make(map[string]bool, len(selected))
+	for _, phase := range selected {
+		names[phase.Name] = true
+	}
+	for _, phase := range selected {
+		for _, dep := range phase.DependsOn {
+			if !names[dep] && checkpoints[dep].Status != PhaseCompleted {
+				return nil, fmt.Errorf("phase %s depends on %s, which has not completed; run it first", phase.Name, dep)
+			}
+		}
+	}
+	return selected, nil
+}
+
 // RunControlPlaneBootstrap orchestrates the installation and configuration
-// of SaltStack (master/minion), HashiCorp Vault, and Incus for a control plane.
-func RunControlPlaneBootstrap(dryRun bool, saltUserPassword string) error {
+// of SaltStack (master/minion), HashiCorp Vault, Incus and Pass for a control
+// plane. The outcome of each phase is recorded in store, except on a dry run.
+// A failed phase does not stop the phases that do not depend on it, so that
+// a later run with Resume only retries what failed.
+func RunControlPlaneBootstrap(ctx context.Context, store *CheckpointStore, opts Options) error {
 	mainGoroutineName := "lady-guica" // Main goroutine name
-	log.Info(fmt.Sprintf("%s is starting control plane bootstrapping process... %s", mainGoroutineName, log.GetRandomSlothEmoji()), "dry_run", dryRun)
+	log.Info(fmt.Sprintf("%s is starting control plane bootstrapping process... %s", mainGoroutineName, log.GetRandomSlothEmoji()), "dry_run", opts.DryRun, "resume", opts.Resume)
+
+	checkpoints, err := store.Checkpoints()
+	if err != nil {
+		return err
+	}
+	selected, err := selectPhases(opts, checkpoints)
+	if err != nil {
+		return err
+	}
 
 	var wg sync.WaitGroup
-	errChan := make(chan error, 4) // Buffer for 4 potential errors
-
-	// 1. Install and Configure Vault (can run in parallel)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		goroutineName := common.GetRandomGoroutineName()
-		log.Info(fmt.Sprintf("%s is starting Vault setup %s", goroutineName, log.GetRandomSlothEmoji()))
-		if err := vault.InstallAndConfigureVault(goroutineName, dryRun); err != nil {
-			errChan <- fmt.Errorf("%s: Vault bootstrap failed: %w", goroutineName, err)
-		}
-		log.Info(fmt.Sprintf("%s: Vault setup complete %s", goroutineName, log.GetRandomSlothEmoji()))
-	}()
-
-	// 2. Install and Configure Incus (can run in parallel)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		goroutineName := common.GetRandomGoroutineName()
-		log.Info(fmt.Sprintf("%s is starting Incus setup %s", goroutineName, log.GetRandomSlothEmoji()))
-		if err := incus.InstallAndConfigureIncus(goroutineName, dryRun); err != nil {
-			errChan <- fmt.Errorf("%s: Incus bootstrap failed: %w", goroutineName, err)
-		}
-		log.Info(fmt.Sprintf("%s: Incus setup complete %s", goroutineName, log.GetRandomSlothEmoji()))
-	}()
-
-	// 3. Install and Configure SaltStack (master and minion) (can run in parallel)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		goroutineName := common.GetRandomGoroutineName()
-		log.Info(fmt.Sprintf("%s is starting SaltStack setup %s", goroutineName, log.GetRandomSlothEmoji()))
-		if err := salt.InstallAndConfigureSalt(goroutineName, dryRun, true, saltUserPassword); err != nil {
-			errChan <- fmt.Errorf("%s: SaltStack bootstrap failed: %w", goroutineName, err)
+	var mu sync.Mutex
+	results := make(map[string]error, len(selected))
+	done := make(map[string]chan struct{}, len(selected))
+	for _, phase := range selected {
+		done[phase.Name] = make(chan struct{})
+	}
+
+	// A phase runs again on resume if a phase it depends on runs, e.g.
+	// vault-init after vault; selected is in dependency order.
+	running := make(map[string]bool, len(selected))
+	for _, phase := range selected {
+		inputsHash := phase.InputsHash(opts)
+		depRuns := false
+		for _, dep := range phase.DependsOn {
+			depRuns = depRuns || running[dep]
 		}
-		log.Info(fmt.Sprintf("%s: SaltStack setup complete %s", goroutineName, log.GetRandomSlothEmoji()))
-	}()
-
-	// 4. Install and Configure Pass (can run in parallel)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		goroutineName := common.GetRandomGoroutineName()
-		log.Info(fmt.Sprintf("%s is starting Pass setup %s", goroutineName, log.GetRandomSlothEmoji()))
-		if err := pass.InstallAndConfigurePass(goroutineName, dryRun); err != nil {
-			errChan <- fmt.Errorf("%s: Pass bootstrap failed: %w", goroutineName, err)
+		if opts.Resume && !depRuns && checkpoints[phase.Name].Completed(inputsHash) {
+			log.Info(fmt.Sprintf("%s: Phase already completed, skipping.", mainGoroutineName), "phase", phase.Name, "completed_at", checkpoints[phase.Name].FinishedAt)
+			close(done[phase.Name])
+			continue
 		}
-		log.Info(fmt.Sprintf("%s: Pass setup complete %s", goroutineName, log.GetRandomSlothEmoji()))
-	}()
+		running[phase.Name] = true
+
+		wg.Add(1)
+		go func(phase Phase) {
+			defer wg.Done()
+			defer close(done[phase.Name])
 
-	wg.Wait()      // Wait for all goroutines to finish
-	close(errChan) // Close the channel after all goroutines are done
+			// Phases outside this run have completed earlier; see selectPhases.
+			for _, dep := range phase.DependsOn {
+				if ch, ok := done[dep]; ok {
+					<-ch
+				}
+			}
+			mu.Lock()
+			for _, dep := range phase.DependsOn {
+				if results[dep] != nil {
+					results[phase.Name] = fmt.Errorf("%w: %s", errDependencyFailed, dep)
+				}
+			}
+			skipped := results[phase.Name] != nil
+			mu.Unlock()
+			if skipped {
+				log.Warn(fmt.Sprintf("%s: Skipping phase, a phase it depends on did not complete.", mainGoroutineName), "phase", phase.Name)
+				return
+			}
 
-	// Check for errors from goroutines
-	for err := range errChan {
-		if err != nil {
-			return err // Return the first error encountered
+			goroutineName := common.GetRandomGoroutineName()
+			log.Info(fmt.Sprintf("%s is starting %s phase %s", goroutineName, phase.Name, log.GetRandomSlothEmoji()))
+			checkpoint := Checkpoint{Phase: phase.Name, InputsHash: inputsHash, StartedAt: time.Now().UTC()}
+			outputs, err := phase.Run(ctx, goroutineName, opts)
+			if err == nil {
+				err = ctx.Err() // A phase interrupted part way has not completed.
+			}
+			checkpoint.FinishedAt = time.Now().UTC()
+			if err != nil {
+				checkpoint.Status = PhaseFailed
+				checkpoint.Error = err.Error()
+				log.Error(fmt.Sprintf("%s: %s phase failed.", goroutineName, phase.Name), "error", err)
+			} else {
+				checkpoint.Status = PhaseCompleted
+				checkpoint.Outputs = outputs
+				log.Info(fmt.Sprintf("%s: %s phase complete %s", goroutineName, phase.Name, log.GetRandomSlothEmoji()))
+			}
+
+			if !opts.DryRun {
+				if recordErr := store.Record(checkpoint); recordErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to record checkpoint: %w", recordErr))
+				}
+			}
+			mu.Lock()
+			results[phase.Name] = err
+			mu.Unlock()
+		}(phase)
+	}
+
+	wg.Wait() // Wait for all goroutines to finish
+
+	// Report failures in phase order; phases skipped for a failed dependency
+	// are retried along with it.
+	var errs []error
+	for _, phase := range selected {
+		if err := results[phase.Name]; err != nil && !errors.Is(err, errDependencyFailed) {
+			errs = append(errs, fmt.Errorf("%s phase failed: %w", phase.Name, err))
 		}
 	}
+	if len(errs) > 0 {
+		log.Warn(fmt.Sprintf("%s: Control plane bootstrap did not complete; re-run with --resume to retry the phases that did not complete.", mainGoroutineName))
+		return errors.Join(errs...)
+	}
 
 	log.Info(fmt.Sprintf("%s: Control plane bootstrapping process complete. %s", mainGoroutineName, log.GetRandomSlothEmoji()))
 	return nil
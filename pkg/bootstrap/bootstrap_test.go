@@ -0,0 +1,83 @@
+package bootstrap
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResumeRerunsDependentsOfPhasesThatRun(t *testing.T) {
+	var mu sync.Mutex
+	var ran []string
+	config := "v1"
+	phase := func(name string, inputs func() string, dependsOn ...string) Phase {
+		return Phase{
+			Name:      name,
+			DependsOn: dependsOn,
+			Inputs:    func(Options) []string { return []string{inputs()} },
+			Run: func(ctx context.Context, goroutineName string, opts Options) (map[string]string, error) {
+				mu.Lock()
+				ran = append(ran, name)
+				mu.Unlock()
+				return nil, nil
+			},
+		}
+	}
+	fixed := func() string { return "fixed" }
+	defer func(phases []Phase) { Phases = phases }(Phases)
+	Phases = []Phase{
+		phase("vault", func() string { return config }),
+		phase("pass", fixed),
+		phase("vault-init", fixed, "vault", "pass"),
+		phase("incus", fixed),
+	}
+
+	store := NewCheckpointStore(filepath.Join(t.TempDir(), "state.db"))
+	runs := []struct {
+		name string
+		want string
+	}{
+		{name: "first run", want: "incus,pass,vault,vault-init"},
+		{name: "unchanged", want: ""},
+		{name: "vault config changed", want: "vault,vault-init"},
+	}
+	for _, run := range runs {
+		if run.name == "vault config changed" {
+			config = "v2"
+		}
+		ran = nil
+		if err := RunControlPlaneBootstrap(context.Background(), store, Options{Resume: true}); err != nil {
+			t.Fatalf("%s: %v", run.name, err)
+		}
+		sort.Strings(ran)
+		if got := strings.Join(ran, ","); got != run.want {
+			t.Errorf("%s: ran %q, want %q", run.name, got, run.want)
+		}
+	}
+}
+
+func TestSaltUserInputsDoNotDependOnThePassword(t *testing.T) {
+	for _, phase := range Phases {
+		if phase.Name != "salt-user" {
+			continue
+		}
+		first := phase.InputsHash(Options{SaltUserPassword: "first-secret"})
+		second := phase.InputsHash(Options{SaltUserPassword: "second-secret"})
+		if first != second {
+			t.Errorf("salt-user inputs hash changes with the password")
+		}
+		for _, input := range phase.Inputs(Options{SaltUserPassword: "first-secret"}) {
+			if strings.Contains(input, "first-secret") {
+				t.Errorf("salt-user inputs contain the password: %q", input)
+			}
+		}
+		if first == phase.InputsHash(Options{}) {
+			t.Errorf("salt-user inputs hash does not change when no user is created")
+		}
+		return
+	}
+	t.Fatal("no salt-user phase")
+}
@@ -0,0 +1,106 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// CheckpointBucket holds the outcome of the last run of each bootstrap phase.
+const CheckpointBucket = "slothctl_bootstrap"
+
+// checkpointDBTimeout is how long to wait for another slothctl process to
+// release the database.
+const checkpointDBTimeout = 5 * time.Second
+
+// PhaseStatus is the outcome of a bootstrap phase.
+type PhaseStatus string
+
+const (
+	PhaseCompleted PhaseStatus = "completed"
+	PhaseFailed    PhaseStatus = "failed"
+)
+
+// Checkpoint records the last run of a bootstrap phase.
+type Checkpoint struct {
+	Phase      string            `json:"phase"`
+	Status     PhaseStatus       `json:"status"`
+	InputsHash string            `json:"inputs_hash"`       // Hash of the inputs the phase ran with
+	Outputs    map[string]string `json:"outputs,omitempty"` // What the phase produced, e.g. configuration paths
+	Error      string            `json:"error,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+}
+
+// Completed reports whether the phase completed with the given inputs.
+func (c Checkpoint) Completed(inputsHash string) bool {
+	return c.Status == PhaseCompleted && c.InputsHash == inputsHash
+}
+
+// CheckpointStore records bootstrap checkpoints in the BoltDB file at dbPath.
+// Like the state manager, it opens the file for each transaction so other
+// slothctl commands can use the database while a long bootstrap runs.
+type CheckpointStore struct {
+	dbPath string
+	mu     sync.Mutex
+}
+
+// NewCheckpointStore creates a CheckpointStore backed by the BoltDB file at dbPath.
+func NewCheckpointStore(dbPath string) *CheckpointStore {
+	return &CheckpointStore{dbPath: dbPath}
+}
+
+// Checkpoints returns the recorded checkpoints by phase name.
+func (s *CheckpointStore) Checkpoints() (map[string]Checkpoint, error) {
+	checkpoints := make(map[string]Checkpoint)
+	err := s.withDB(func(db *bbolt.DB) error {
+		return db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(CheckpointBucket))
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				var checkpoint Checkpoint
+				if err := json.Unmarshal(v, &checkpoint); err != nil {
+					return fmt.Errorf("failed to decode checkpoint of phase %s: %w", k, err)
+				}
+				checkpoints[string(k)] = checkpoint
+				return nil
+			})
+		})
+	})
+	return checkpoints, err
+}
+
+// Record stores the checkpoint of a phase, replacing the previous one.
+func (s *CheckpointStore) Record(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint of phase %s: %w", checkpoint.Phase, err)
+	}
+	return s.withDB(func(db *bbolt.DB) error {
+		return db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(CheckpointBucket))
+			if err != nil {
+				return fmt.Errorf("create bucket: %w", err)
+			}
+			return b.Put([]byte(checkpoint.Phase), data)
+		})
+	})
+}
+
+// withDB opens the database, runs fn and closes it again.
+func (s *CheckpointStore) withDB(fn func(db *bbolt.DB) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, err := bbolt.Open(s.dbPath, 0600, &bbolt.Options{Timeout: checkpointDBTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open BoltDB %s: %w", s.dbPath, err)
+	}
+	defer db.Close()
+	return fn(db)
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// AccountFiles are the passwd and group files users and groups are read from.
+// Tests point them at fixture files.
+type AccountFiles struct {
+	PasswdPath string
+	GroupPath  string
+}
+
+// SystemAccountFiles are the account files of the running host.
+var SystemAccountFiles = AccountFiles{PasswdPath: "/etc/passwd", GroupPath: "/etc/group"}
+
+// PasswdEntry is a line of a passwd file.
+type PasswdEntry struct {
+	Name  string
+	UID   string
+	GID   string
+	Gecos string
+	Home  string
+	Shell string
+}
+
+// GroupEntry is a line of a group file.
+type GroupEntry struct {
+	Name    string
+	GID     string
+	Members []string
+}
+
+// UserAccount is a user together with its group memberships.
+type UserAccount struct {
+	PasswdEntry
+	PrimaryGroup string   // Name of the group with the user's GID, or the GID if it has no entry
+	Groups       []string // Supplementary groups, sorted
+}
+
+// ParsePasswd parses a passwd file: name:password:uid:gid:gecos:home:shell.
+func ParsePasswd(r io.Reader) ([]PasswdEntry, error) {
+	var entries []PasswdEntry
+	err := scanAccountFile(r, 7, func(fields []string) {
+		entries = append(entries, PasswdEntry{
+			Name:  fields[0],
+			UID:   fields[2],
+			GID:   fields[3],
+			Gecos: fields[4],
+			Home:  fields[5],
+			Shell: fields[6],
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid passwd file: %w", err)
+	}
+	return entries, nil
+}
+
+// ParseGroup parses a group file: name:password:gid:member,member.
+func ParseGroup(r io.Reader) ([]GroupEntry, error) {
+	var entries []GroupEntry
+	err := scanAccountFile(r, 4, func(fields []string) {
+		entry := GroupEntry{Name: fields[0], GID: fields[2]}
+		if fields[3] != "" {
+			entry.Members = strings.Split(fields[3], ",")
+		}
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid group file: %w", err)
+	}
+	return entries, nil
+}
+
+// scanAccountFile calls fn with the colon-separated fields of every entry.
+// Blank lines, comments and NIS compat entries starting with + or - are skipped.
+func scanAccountFile(r io.Reader, numFields int, fn func(fields []string)) error {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != numFields {
+			return fmt.Errorf("line %d: expected %d fields, got %d", lineNo, numFields, len(fields))
+		}
+		fn(fields)
+	}
+	return scanner.Err()
+}
+
+// Passwd reads the passwd file on the host of ctx's executor.
+func (f AccountFiles) Passwd(ctx context.Context) ([]PasswdEntry, error) {
+	data, err := ExecutorFrom(ctx).ReadFile(ctx, f.PasswdPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.PasswdPath, err)
+	}
+	return ParsePasswd(bytes.NewReader(data))
+}
+
+// Group reads the group file on the host of ctx's executor.
+func (f AccountFiles) Group(ctx context.Context) ([]GroupEntry, error) {
+	data, err := ExecutorFrom(ctx).ReadFile(ctx, f.GroupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.GroupPath, err)
+	}
+	return ParseGroup(bytes.NewReader(data))
+}
+
+// LookupUser returns a user and its group memberships, or nil if the user
+// does not exist.
+func (f AccountFiles) LookupUser(ctx context.Context, name string) (*UserAccount, error) {
+	users, err := f.Passwd(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var account *UserAccount
+	for _, entry := range users {
+		if entry.Name == name {
+			account = &UserAccount{PasswdEntry: entry, PrimaryGroup: entry.GID}
+			break
+		}
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	groups, err := f.Group(ctx)
+	if err != nil {
+		return nil, err
+	}
+	account.Groups = []string{}
+	for _, group := range groups {
+		if group.GID == account.GID {
+			account.PrimaryGroup = group.Name
+		}
+		for _, member := range group.Members {
+			if member == name {
+				account.Groups = append(account.Groups, group.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(account.Groups)
+	return account, nil
+}
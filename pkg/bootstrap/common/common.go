@@ -2,24 +2,46 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math/rand" // For random goroutine names
 	"os/exec"
+	"strings"
+	"syscall"
 	"time" // For seeding rand
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/google/uuid"
 )
 
-// RunCommand executes a shell command and logs its output.
-func RunCommand(goroutineName string, dryRun bool, stdin io.Reader, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
+// commandWaitDelay is how long a cancelled command may take to exit after
+// SIGTERM before it is killed.
+const commandWaitDelay = 10 * time.Second
+
+// newCommand creates a local command that is terminated when ctx is done. It
+// is sent SIGTERM first, which sudo and ssh relay to the command they run, and
+// killed if it has not exited after commandWaitDelay.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// RunCommand executes a shell command on the host of ctx's executor and logs
+// its output. The command is terminated if ctx is cancelled or its deadline
+// passes.
+func RunCommand(ctx context.Context, goroutineName string, dryRun bool, stdin io.Reader, name string, args ...string) error {
+	executor := ExecutorFrom(ctx)
+	cmd := executor.Command(ctx, name, args...)
 	cmd.Stdout = log.NewWriter(log.Info)
 	cmd.Stderr = log.NewWriter(log.Error)
 	cmd.Stdin = stdin
 
-	log.Info(fmt.Sprintf("%s is handling command: %s", goroutineName, cmd.String()), "dry_run", dryRun)
+	log.Info(fmt.Sprintf("%s is handling command: %s", goroutineName, strings.Join(append([]string{name}, args...), " ")), "host", executor, "dry_run", dryRun)
 
 	if dryRun {
 		log.Info(fmt.Sprintf("%s: Dry run: Command not executed.", goroutineName))
@@ -27,38 +49,155 @@ func RunCommand(goroutineName string, dryRun bool, stdin io.Reader, name string,
 	}
 
 	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("command failed: %s %w (%w)", cmd.String(), err, ctxErr)
+		}
 		return fmt.Errorf("command failed: %s %w", cmd.String(), err)
 	}
 	return nil
 }
 
-// InstallPackages installs a list of packages using pacman.
-func InstallPackages(goroutineName string, dryRun bool, packages []string) error {
-	log.Info(fmt.Sprintf("%s is installing packages: %v", goroutineName, packages), "dry_run", dryRun)
-	args := []string{"--noconfirm", "-S"}
-	args = append(args, packages...)
-	return RunCommand(goroutineName, dryRun, nil, "sudo", append([]string{"pacman"}, args...)...)
+// InstallPackages installs a list of packages with the distribution's package
+// manager. Names are resolved with ResolvePackageName, and packages that are
+// already installed are skipped.
+func InstallPackages(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	pm, err := DetectPackageManager(ctx)
+	if err != nil {
+		return err
+	}
+	var missing []Package
+	seen := make(map[string]bool)
+	for _, pkg := range packages {
+		name := ResolvePackageName(pm.Name(), pkg)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, installed, err := pm.InstalledVersion(ctx, name); err != nil {
+			return err
+		} else if installed {
+			log.Info(fmt.Sprintf("%s: Package is already installed.", goroutineName), "package", name)
+			continue
+		}
+		missing = append(missing, Package{Name: name})
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	log.Info(fmt.Sprintf("%s is installing packages: %v", goroutineName, missing), "package_manager", pm.Name(), "dry_run", dryRun)
+	return pm.Install(ctx, goroutineName, dryRun, missing)
 }
 
-// CreateUser creates a system user with a specified password.
-func CreateUser(goroutineName string, dryRun bool, username, password string) error {
+// RemovePackages removes a list of packages, and their unneeded dependencies,
+// with the distribution's package manager.
+func RemovePackages(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	pm, err := DetectPackageManager(ctx)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, pkg := range packages {
+		names = append(names, ResolvePackageName(pm.Name(), pkg))
+	}
+	log.Info(fmt.Sprintf("%s is removing packages: %v", goroutineName, names), "package_manager", pm.Name(), "dry_run", dryRun)
+	return pm.Remove(ctx, goroutineName, dryRun, names)
+}
+
+// Systemctl runs a systemctl action, such as enable or restart, on systemd units.
+func Systemctl(ctx context.Context, goroutineName string, dryRun bool, action string, units ...string) error {
+	log.Info(fmt.Sprintf("%s is running systemctl %s on: %v", goroutineName, action, units), "dry_run", dryRun)
+	args := append([]string{"systemctl", action}, units...)
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+// EnsureService enables and starts a systemd unit unless it already is, so
+// that a running service is left alone. With restart set, a unit that was
+// already running is restarted, e.g. to pick up a changed configuration.
+func EnsureService(ctx context.Context, goroutineName string, dryRun bool, unit string, restart bool) error {
+	enabled, active, err := ServiceStatus(ctx, unit)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		if err := Systemctl(ctx, goroutineName, dryRun, "enable", unit); err != nil {
+			return fmt.Errorf("failed to enable %s: %w", unit, err)
+		}
+	}
+	switch {
+	case !active:
+		if err := Systemctl(ctx, goroutineName, dryRun, "start", unit); err != nil {
+			return fmt.Errorf("failed to start %s: %w", unit, err)
+		}
+	case restart:
+		if err := Systemctl(ctx, goroutineName, dryRun, "restart", unit); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", unit, err)
+		}
+	default:
+		log.Info(fmt.Sprintf("%s: Service is already running.", goroutineName), "unit", unit)
+	}
+	return nil
+}
+
+// DisableService stops and disables systemd units.
+func DisableService(ctx context.Context, goroutineName string, dryRun bool, units ...string) error {
+	log.Info(fmt.Sprintf("%s is stopping and disabling services: %v", goroutineName, units), "dry_run", dryRun)
+	args := append([]string{"systemctl", "disable", "--now"}, units...)
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+// UserOptions are the account attributes set by CreateUser and ModifyUser.
+// Empty fields are left to the system defaults, or unchanged.
+type UserOptions struct {
+	UID    string
+	GID    string // Primary group, by number or name
+	Shell  string
+	Groups []string // Supplementary groups; only applied if SetGroups is set
+	// SetGroups replaces the supplementary groups with Groups, so that an
+	// empty list removes the user from all of them.
+	SetGroups bool
+}
+
+// args returns the useradd and usermod flags for the options.
+func (o UserOptions) args() []string {
+	var args []string
+	if o.UID != "" {
+		args = append(args, "-u", o.UID)
+	}
+	if o.GID != "" {
+		args = append(args, "-g", o.GID)
+	}
+	if o.Shell != "" {
+		args = append(args, "-s", o.Shell)
+	}
+	if o.SetGroups {
+		args = append(args, "-G", strings.Join(o.Groups, ","))
+	}
+	return args
+}
+
+// CreateUser creates a system user with a specified password and attributes.
+func CreateUser(ctx context.Context, goroutineName string, dryRun bool, username, password string, opts UserOptions) error {
 	log.Info(fmt.Sprintf("%s is creating system user: %s", goroutineName, username), "dry_run", dryRun)
 
 	// Check if user already exists
-	if err := RunCommand(goroutineName, dryRun, nil, "id", "-u", username); err == nil {
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "id", "-u", username); err == nil {
 		log.Info(fmt.Sprintf("%s: User already exists.", goroutineName), "username", username)
 		return nil
 	}
 
 	// Create user
-	if err := RunCommand(goroutineName, dryRun, nil, "sudo", "useradd", "-m", "-s", "/bin/bash", username); err != nil {
+	if opts.Shell == "" {
+		opts.Shell = "/bin/bash"
+	}
+	args := append(append([]string{"useradd", "-m"}, opts.args()...), username)
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...); err != nil {
 		return fmt.Errorf("failed to create user %s: %w", username, err)
 	}
 
 	// Set password
 	if password != "" {
 		log.Info(fmt.Sprintf("%s is setting password for user: %s", goroutineName, username), "dry_run", dryRun)
-		cmd := exec.Command("sudo", "chpasswd")
+		cmd := ExecutorFrom(ctx).Command(ctx, "sudo", "chpasswd")
 		cmd.Stdin = bytes.NewBufferString(fmt.Sprintf("%s:%s", username, password))
 		cmd.Stdout = log.NewWriter(log.Info)
 		cmd.Stderr = log.NewWriter(log.Error)
@@ -79,6 +218,37 @@ func CreateUser(goroutineName string, dryRun bool, username, password string) er
 	return nil
 }
 
+// ModifyUser changes the attributes of an existing system user with usermod.
+func ModifyUser(ctx context.Context, goroutineName string, dryRun bool, username string, opts UserOptions) error {
+	log.Info(fmt.Sprintf("%s is modifying system user: %s", goroutineName, username), "dry_run", dryRun)
+	flags := opts.args()
+	if len(flags) == 0 {
+		return nil
+	}
+	args := append(append([]string{"usermod"}, flags...), username)
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...); err != nil {
+		return fmt.Errorf("failed to modify user %s: %w", username, err)
+	}
+	return nil
+}
+
+// DeleteUser deletes a system user. The home directory is kept so that no data
+// is lost by removing a user from the manifest.
+func DeleteUser(ctx context.Context, goroutineName string, dryRun bool, username string) error {
+	log.Info(fmt.Sprintf("%s is deleting system user: %s", goroutineName, username), "dry_run", dryRun)
+
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "id", "-u", username); err != nil && !dryRun {
+		log.Info(fmt.Sprintf("%s: User does not exist.", goroutineName), "username", username)
+		return nil
+	}
+
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "userdel", username); err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", username, err)
+	}
+	log.Info(fmt.Sprintf("%s: User deleted.", goroutineName), "username", username)
+	return nil
+}
+
 // GenerateUUID generates a new UUID string.
 func GenerateUUID() string {
 	return uuid.New().String()
@@ -91,9 +261,3 @@ func GetRandomGoroutineName() string {
 	rand.Seed(time.Now().UnixNano())
 	return goroutineNames[rand.Intn(len(goroutineNames))]
 }
-
-// AddUserToGroup adds a user to a specified group.
-func AddUserToGroup(goroutineName string, dryRun bool, username, group string) error {
-	log.Info(fmt.Sprintf("%s is adding user %s to group %s", goroutineName, username, group), "dry_run", dryRun)
-	return RunCommand(goroutineName, dryRun, nil, "sudo", "usermod", "-aG", group, username)
-}
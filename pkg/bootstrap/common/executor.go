@@ -0,0 +1,236 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Executor runs commands and reads files on the host being converged. Bootstrap
+// and resource code reach it through the context, so the same code converges
+// the local host or a remote one.
+type Executor interface {
+	// Command returns a command that runs name with args on the host. It is
+	// terminated when ctx is done.
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+	// ReadFile returns the content of a file, read as root where the file is
+	// not readable otherwise, since files are written as root. A missing file is reported with an error matching
+	// os.ErrNotExist.
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	// Stat returns the ownership and permissions of a file, with the same
+	// error for a missing file as ReadFile.
+	Stat(ctx context.Context, path string) (FileStat, error)
+	// Host is the address at which the host's network services are reached.
+	Host() string
+	// String describes the host in logs, e.g. "local" or "admin@10.0.0.5".
+	String() string
+}
+
+// FileStat is the ownership and permissions of a file.
+type FileStat struct {
+	Owner string
+	Group string
+	Mode  os.FileMode // Permission bits only
+	IsDir bool
+}
+
+type executorKey struct{}
+
+// WithExecutor returns a context whose commands and file reads are carried
+// out by executor.
+func WithExecutor(ctx context.Context, executor Executor) context.Context {
+	return context.WithValue(ctx, executorKey{}, executor)
+}
+
+// ExecutorFrom returns the executor of ctx, or the local host if none is set.
+func ExecutorFrom(ctx context.Context) Executor {
+	if executor, ok := ctx.Value(executorKey{}).(Executor); ok {
+		return executor
+	}
+	return Local
+}
+
+// Local runs commands on the host slothctl runs on.
+var Local Executor = localExecutor{}
+
+type localExecutor struct{}
+
+func (localExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return newCommand(ctx, name, args...)
+}
+
+// ReadFile reads the file directly, and retries through sudo if that is
+// denied, since files are written through sudo and may be readable only by
+// root.
+func (e localExecutor) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if needsSudo(err) {
+		return privilegedFile(ctx, e, path, readFileScript)
+	}
+	return data, err
+}
+
+// Stat stats the file directly, and retries through sudo if that is denied.
+func (e localExecutor) Stat(ctx context.Context, path string) (FileStat, error) {
+	info, err := os.Stat(path)
+	if needsSudo(err) {
+		output, err := privilegedFile(ctx, e, path, statFileScript)
+		if err != nil {
+			return FileStat{}, err
+		}
+		return parseStat(output, path, e)
+	}
+	if err != nil {
+		return FileStat{}, err
+	}
+	stat := FileStat{Mode: info.Mode().Perm(), IsDir: info.IsDir()}
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		stat.Owner = ownerName(sys.Uid)
+		stat.Group = groupName(sys.Gid)
+	}
+	return stat, nil
+}
+
+// needsSudo reports whether a local file access was denied to a user other
+// than root, who may still reach the file through sudo.
+func needsSudo(err error) bool {
+	return errors.Is(err, os.ErrPermission) && os.Geteuid() != 0
+}
+
+func (localExecutor) Host() string   { return "127.0.0.1" }
+func (localExecutor) String() string { return "local" }
+
+// ownerName returns the name of a user ID, or the ID itself if it has no name.
+func ownerName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// groupName returns the name of a group ID, or the ID itself if it has no name.
+func groupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// SSHExecutor runs commands on a remote host over ssh, using the operator's
+// ssh configuration and agent for authentication. Commands that need root
+// run through sudo on the remote host, which must not prompt for a password.
+type SSHExecutor struct {
+	User    string
+	Address string // Host name or IP address
+	Port    int    // 0 for the ssh default
+}
+
+// NewSSHExecutor returns an executor for user@address.
+func NewSSHExecutor(user, address string) *SSHExecutor {
+	return &SSHExecutor{User: user, Address: address}
+}
+
+// sshOptions make ssh fail instead of prompting, and share one connection
+// between the many short commands of a run.
+func (s *SSHExecutor) sshOptions() []string {
+	opts := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(os.TempDir(), "slothctl-ssh-%C"),
+		"-o", "ControlPersist=60s",
+	}
+	if s.Port != 0 {
+		opts = append(opts, "-p", strconv.Itoa(s.Port))
+	}
+	return opts
+}
+
+// Command runs the command through ssh. Arguments are quoted for the remote
+// shell, so they arrive exactly as given.
+func (s *SSHExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	quoted := make([]string, 0, len(args)+1)
+	for _, arg := range append([]string{name}, args...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	sshArgs := append(s.sshOptions(), s.destination(), "--", strings.Join(quoted, " "))
+	return newCommand(ctx, "ssh", sshArgs...)
+}
+
+func (s *SSHExecutor) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	return privilegedFile(ctx, s, path, readFileScript)
+}
+
+func (s *SSHExecutor) Stat(ctx context.Context, path string) (FileStat, error) {
+	output, err := privilegedFile(ctx, s, path, statFileScript)
+	if err != nil {
+		return FileStat{}, err
+	}
+	return parseStat(output, path, s)
+}
+
+func (s *SSHExecutor) Host() string { return s.Address }
+
+func (s *SSHExecutor) String() string { return s.destination() }
+
+func (s *SSHExecutor) destination() string {
+	if s.User == "" {
+		return s.Address
+	}
+	return s.User + "@" + s.Address
+}
+
+// Scripts run by privilegedFile on the file given as $1.
+const (
+	readFileScript = `exec cat -- "$1"`
+	statFileScript = `exec stat -L -c '%U %G %a %F' -- "$1"`
+)
+
+// fileMissing is the exit status of privileged file reads for a missing file.
+const fileMissing = 66
+
+// privilegedFile runs a script on a file as root through sudo on the
+// executor's host, exiting with fileMissing if the file does not exist.
+func privilegedFile(ctx context.Context, executor Executor, path, script string) ([]byte, error) {
+	cmd := executor.Command(ctx, "sudo", "sh", "-c", `[ -e "$1" ] || exit `+strconv.Itoa(fileMissing)+`; `+script, "sh", path)
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == fileMissing {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s on %s: %w", path, executor, err)
+	}
+	return output, nil
+}
+
+// parseStat parses the output of statFileScript.
+func parseStat(output []byte, path string, executor Executor) (FileStat, error) {
+	// The file type may contain spaces, e.g. "regular file".
+	fields := strings.Fields(string(output))
+	if len(fields) < 4 {
+		return FileStat{}, fmt.Errorf("unexpected stat output for %s on %s: %q", path, executor, string(output))
+	}
+	mode, err := strconv.ParseUint(fields[2], 8, 32)
+	if err != nil {
+		return FileStat{}, fmt.Errorf("unexpected mode %q of %s on %s", fields[2], path, executor)
+	}
+	fileType := strings.Join(fields[3:], " ")
+	return FileStat{Owner: fields[0], Group: fields[1], Mode: os.FileMode(mode), IsDir: fileType == "directory"}, nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,./:@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
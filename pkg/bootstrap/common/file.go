@@ -0,0 +1,101 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+// BackupSuffix is appended to a file's path to name the copy of its previous
+// version kept by WriteFileAtomic and RemoveFile.
+const BackupSuffix = ".slothctl.bak"
+
+// stagedSuffix names the temporary file WriteFileAtomic renames into place.
+const stagedSuffix = ".slothctl.new"
+
+// FileOptions are the ownership and permissions of a file written by WriteFileAtomic.
+type FileOptions struct {
+	Owner  string
+	Group  string
+	Mode   os.FileMode
+	Backup bool // Keep the previous version as path + BackupSuffix
+}
+
+// ConfigFileOptions are the options for configuration files written by bootstrap.
+var ConfigFileOptions = FileOptions{Owner: "root", Group: "root", Mode: 0644, Backup: true}
+
+// WriteFileAtomic writes content to path with the given ownership and mode.
+// The content is staged next to the target and renamed over it, so readers
+// never see a partially written file. Parent directories are created as
+// needed. Unlike writing through a shell, the content is passed verbatim on
+// standard input, which also carries it to remote hosts.
+func WriteFileAtomic(ctx context.Context, goroutineName string, dryRun bool, path string, content []byte, opts FileOptions) error {
+	log.Info(fmt.Sprintf("%s is writing file: %s", goroutineName, path), "mode", fmt.Sprintf("%04o", opts.Mode), "dry_run", dryRun)
+
+	staged := path + stagedSuffix
+	args := []string{"install", "-D", "-m", fmt.Sprintf("%04o", opts.Mode)}
+	if opts.Owner != "" {
+		args = append(args, "-o", opts.Owner)
+	}
+	if opts.Group != "" {
+		args = append(args, "-g", opts.Group)
+	}
+	args = append(args, "/dev/stdin", staged)
+	if err := RunCommand(ctx, goroutineName, dryRun, bytes.NewReader(content), "sudo", args...); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+
+	if opts.Backup {
+		if _, err := ExecutorFrom(ctx).Stat(ctx, path); err == nil {
+			if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "cp", "-p", "-f", "--", path, path+BackupSuffix); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", path, err)
+			}
+		}
+	}
+
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "mv", "-f", "-T", "--", staged, path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+	return nil
+}
+
+// EnsureFile writes content to path with WriteFileAtomic unless the file
+// already has exactly that content. It reports whether the file was written,
+// so that services are only restarted when their configuration changed.
+func EnsureFile(ctx context.Context, goroutineName string, dryRun bool, path string, content []byte, opts FileOptions) (bool, error) {
+	checksum, exists, err := FileChecksum(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if exists && checksum == Checksum(content) {
+		log.Info(fmt.Sprintf("%s: File is up to date.", goroutineName), "path", path)
+		return false, nil
+	}
+	if err := WriteFileAtomic(ctx, goroutineName, dryRun, path, content, opts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveFile removes a file. With backup set it is moved to path + BackupSuffix
+// instead, so it can be restored with RestoreBackup.
+func RemoveFile(ctx context.Context, goroutineName string, dryRun bool, path string, backup bool) error {
+	log.Info(fmt.Sprintf("%s is removing file: %s", goroutineName, path), "backup", backup, "dry_run", dryRun)
+	if backup {
+		return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "mv", "-f", "-T", "--", path, path+BackupSuffix)
+	}
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "rm", "-f", "--", path)
+}
+
+// RestoreBackup puts back the previous version of a file kept by
+// WriteFileAtomic or RemoveFile.
+func RestoreBackup(ctx context.Context, goroutineName string, dryRun bool, path string) error {
+	log.Info(fmt.Sprintf("%s is restoring file from backup: %s", goroutineName, path), "dry_run", dryRun)
+	if _, err := ExecutorFrom(ctx).Stat(ctx, path+BackupSuffix); err != nil && !dryRun {
+		return fmt.Errorf("no backup of %s to restore: %w", path, err)
+	}
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "mv", "-f", "-T", "--", path+BackupSuffix, path)
+}
@@ -0,0 +1,333 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+// OSReleasePath is where the running distribution is described.
+const OSReleasePath = "/etc/os-release"
+
+// ErrVersionPinUnsupported is returned when a package manager cannot install a
+// specific package version.
+var ErrVersionPinUnsupported = errors.New("package manager cannot install a specific version")
+
+// Package is a package to install, optionally pinned to a version.
+type Package struct {
+	Name    string
+	Version string // Empty for the latest available version
+}
+
+// PackageManager installs, removes and queries system packages. Package names
+// are the distribution's own; see ResolvePackageName.
+type PackageManager interface {
+	// Name is the package manager, e.g. "apt". It selects the per-distribution
+	// package names.
+	Name() string
+	// PinsVersions reports whether Install accepts packages pinned to a
+	// version, rather than failing with ErrVersionPinUnsupported.
+	PinsVersions() bool
+	// InstalledVersion returns the installed version of a package and whether
+	// it is installed at all.
+	InstalledVersion(ctx context.Context, pkg string) (string, bool, error)
+	Install(ctx context.Context, goroutineName string, dryRun bool, packages []Package) error
+	Remove(ctx context.Context, goroutineName string, dryRun bool, packages []string) error
+}
+
+// packageNames maps the package names used by slothctl to the names used by
+// distributions whose packaging differs. Names not listed are the same
+// everywhere. Arch ships master and minion in a single salt package.
+var packageNames = map[string]map[string]string{
+	"salt-master": {"pacman": "salt"},
+	"salt-minion": {"pacman": "salt"},
+	"gnupg":       {"dnf": "gnupg2"},
+}
+
+// ResolvePackageName returns the name of a package for a package manager.
+func ResolvePackageName(manager, pkg string) string {
+	if name, ok := packageNames[pkg][manager]; ok {
+		return name
+	}
+	return pkg
+}
+
+// OSRelease holds the fields of /etc/os-release that identify a distribution.
+type OSRelease struct {
+	ID        string   // e.g. "debian"
+	IDLike    []string // Distributions this one derives from, e.g. ["debian"] on Ubuntu
+	VersionID string
+}
+
+// ParseOSRelease parses the KEY=value lines of an os-release file.
+func ParseOSRelease(r io.Reader) (OSRelease, error) {
+	var release OSRelease
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			release.ID = value
+		case "ID_LIKE":
+			release.IDLike = strings.Fields(value)
+		case "VERSION_ID":
+			release.VersionID = value
+		}
+	}
+	return release, scanner.Err()
+}
+
+// PackageManagerFor returns the package manager of a distribution, matching
+// its ID first and then the distributions it derives from.
+func PackageManagerFor(release OSRelease) (PackageManager, error) {
+	for _, id := range append([]string{release.ID}, release.IDLike...) {
+		switch id {
+		case "arch", "manjaro", "endeavouros":
+			return pacman{}, nil
+		case "debian", "ubuntu":
+			return apt{}, nil
+		case "fedora", "rhel", "centos", "rocky", "almalinux":
+			return dnf{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported distribution %q: no known package manager", release.ID)
+}
+
+var (
+	detectMu         sync.Mutex
+	detectedManagers = make(map[string]PackageManager) // Keyed by executor
+)
+
+// serializedPackageManager lets one install or removal at a time run on a
+// host. Resources and bootstrap phases run in parallel, and concurrent
+// apt-get, dnf or pacman calls fail on the package database lock.
+type serializedPackageManager struct {
+	PackageManager
+	mu *sync.Mutex
+}
+
+func (s serializedPackageManager) Install(ctx context.Context, goroutineName string, dryRun bool, packages []Package) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.PackageManager.Install(ctx, goroutineName, dryRun, packages)
+}
+
+func (s serializedPackageManager) Remove(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.PackageManager.Remove(ctx, goroutineName, dryRun, packages)
+}
+
+// DetectPackageManager returns the package manager of the distribution on the
+// host of ctx's executor, read from its /etc/os-release once per host.
+// Installs and removals through it are serialized per host.
+func DetectPackageManager(ctx context.Context) (PackageManager, error) {
+	executor := ExecutorFrom(ctx)
+	detectMu.Lock()
+	defer detectMu.Unlock()
+	if pm, ok := detectedManagers[executor.String()]; ok {
+		return pm, nil
+	}
+
+	data, err := executor.ReadFile(ctx, OSReleasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", OSReleasePath, err)
+	}
+	release, err := ParseOSRelease(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", OSReleasePath, err)
+	}
+	pm, err := PackageManagerFor(release)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Detected package manager", "host", executor, "distribution", release.ID, "package_manager", pm.Name())
+	pm = serializedPackageManager{PackageManager: pm, mu: &sync.Mutex{}}
+	detectedManagers[executor.String()] = pm
+	return pm, nil
+}
+
+// VersionMatches reports whether an installed version satisfies a pinned one.
+// A pin matches the exact version, or versions that only add a packaging
+// revision, e.g. "1.15.2" matches "1.15.2-1" but not "1.15.20".
+func VersionMatches(installed, pinned string) bool {
+	if pinned == "" || installed == pinned {
+		return true
+	}
+	if !strings.HasPrefix(installed, pinned) {
+		return false
+	}
+	switch installed[len(pinned)] {
+	case '-', '+', '~':
+		return true
+	}
+	return false
+}
+
+// isExitError reports whether err is a command exiting non-zero, as opposed
+// to the command not being found or not starting.
+func isExitError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// pacman is the Arch Linux package manager.
+type pacman struct{}
+
+func (pacman) Name() string { return "pacman" }
+
+// PinsVersions is false, as the Arch repositories only carry the current version.
+func (pacman) PinsVersions() bool { return false }
+
+func (pacman) InstalledVersion(ctx context.Context, pkg string) (string, bool, error) {
+	output, err := CommandOutput(ctx, "pacman", "-Q", pkg)
+	if err != nil {
+		if isExitError(err) {
+			return "", false, nil // pacman exits non-zero for packages that are not installed
+		}
+		return "", false, fmt.Errorf("failed to query package %s: %w", pkg, err)
+	}
+	// Output is "<name> <version>"
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 {
+		return "", false, fmt.Errorf("unexpected pacman output for %s: %q", pkg, string(output))
+	}
+	return fields[1], true, nil
+}
+
+func (pacman) Install(ctx context.Context, goroutineName string, dryRun bool, packages []Package) error {
+	args := []string{"pacman", "--noconfirm", "--needed", "-S"}
+	for _, p := range packages {
+		if p.Version != "" {
+			// The repositories only carry the current version.
+			return fmt.Errorf("%s %s: %w", p.Name, p.Version, ErrVersionPinUnsupported)
+		}
+		args = append(args, p.Name)
+	}
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+func (pacman) Remove(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	args := append([]string{"pacman", "--noconfirm", "-Rns"}, packages...)
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+// apt is the Debian and Ubuntu package manager.
+type apt struct{}
+
+func (apt) Name() string { return "apt" }
+
+func (apt) PinsVersions() bool { return true }
+
+func (apt) InstalledVersion(ctx context.Context, pkg string) (string, bool, error) {
+	output, err := CommandOutput(ctx, "dpkg-query", "-W", "-f", "${db:Status-Status} ${Version}", pkg)
+	if err != nil {
+		if isExitError(err) {
+			return "", false, nil // dpkg-query exits non-zero for unknown packages
+		}
+		return "", false, fmt.Errorf("failed to query package %s: %w", pkg, err)
+	}
+	// Removed packages whose configuration is kept are still known to dpkg.
+	status, version, _ := strings.Cut(strings.TrimSpace(string(output)), " ")
+	if status != "installed" {
+		return "", false, nil
+	}
+	return version, true, nil
+}
+
+func (apt) Install(ctx context.Context, goroutineName string, dryRun bool, packages []Package) error {
+	if err := RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "apt-get", "update", "-q"); err != nil {
+		return fmt.Errorf("failed to update package index: %w", err)
+	}
+	args := []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y", "-q"}
+	for _, p := range packages {
+		if p.Version == "" {
+			args = append(args, p.Name)
+			continue
+		}
+		version, err := aptCandidate(ctx, p)
+		if err != nil {
+			return err
+		}
+		args = append(args, p.Name+"="+version)
+	}
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+// aptCandidate returns the full version apt installs for a pinned package.
+// apt-get only accepts complete versions, so a pin without a Debian revision,
+// e.g. "1.15.2", is resolved to the newest available version it matches,
+// e.g. "1.15.2-1".
+func aptCandidate(ctx context.Context, p Package) (string, error) {
+	if strings.Contains(p.Version, "-") {
+		return p.Version, nil
+	}
+	output, err := CommandOutput(ctx, "apt-cache", "madison", p.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list available versions of %s: %w", p.Name, err)
+	}
+	// Lines are "<name> | <version> | <source>", newest version first.
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 2 {
+			continue
+		}
+		if version := strings.TrimSpace(fields[1]); VersionMatches(version, p.Version) {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("no available version of %s matches %s", p.Name, p.Version)
+}
+
+func (apt) Remove(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	args := append([]string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "remove", "-y", "-q", "--autoremove"}, packages...)
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+// dnf is the Fedora and RHEL package manager.
+type dnf struct{}
+
+func (dnf) Name() string { return "dnf" }
+
+func (dnf) PinsVersions() bool { return true }
+
+func (dnf) InstalledVersion(ctx context.Context, pkg string) (string, bool, error) {
+	output, err := CommandOutput(ctx, "rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}", pkg)
+	if err != nil {
+		if isExitError(err) {
+			return "", false, nil // rpm exits non-zero for packages that are not installed
+		}
+		return "", false, fmt.Errorf("failed to query package %s: %w", pkg, err)
+	}
+	return strings.TrimSpace(string(output)), true, nil
+}
+
+func (dnf) Install(ctx context.Context, goroutineName string, dryRun bool, packages []Package) error {
+	args := []string{"dnf", "install", "-y", "-q"}
+	for _, p := range packages {
+		if p.Version != "" {
+			args = append(args, p.Name+"-"+p.Version)
+		} else {
+			args = append(args, p.Name)
+		}
+	}
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
+
+func (dnf) Remove(ctx context.Context, goroutineName string, dryRun bool, packages []string) error {
+	args := append([]string{"dnf", "remove", "-y", "-q"}, packages...)
+	return RunCommand(ctx, goroutineName, dryRun, nil, "sudo", args...)
+}
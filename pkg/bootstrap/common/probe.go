@@ -0,0 +1,99 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommandOutput runs a read-only command on the host of ctx's executor and
+// returns its standard output.
+// Unlike RunCommand it does not log the output, so it is suited for probing.
+// On a non-zero exit the output is still returned together with the error.
+func CommandOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := ExecutorFrom(ctx).Command(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return output, fmt.Errorf("command failed: %s: %w: %s", cmd.String(), err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// InstalledPackageVersion returns the installed version of a package and
+// whether it is installed at all, using the distribution's package manager.
+func InstalledPackageVersion(ctx context.Context, pkg string) (string, bool, error) {
+	pm, err := DetectPackageManager(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	return pm.InstalledVersion(ctx, ResolvePackageName(pm.Name(), pkg))
+}
+
+// ServiceStatus returns whether a systemd unit is enabled and active.
+func ServiceStatus(ctx context.Context, unit string) (enabled bool, active bool, err error) {
+	// is-enabled and is-active exit non-zero for disabled or inactive units,
+	// so only the printed state matters.
+	enabledOut, err := CommandOutput(ctx, "systemctl", "is-enabled", unit)
+	if err != nil && len(enabledOut) == 0 {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return false, false, fmt.Errorf("failed to query unit %s: %w", unit, err)
+		}
+	}
+	activeOut, _ := CommandOutput(ctx, "systemctl", "is-active", unit)
+
+	enabled = strings.TrimSpace(string(enabledOut)) == "enabled"
+	active = strings.TrimSpace(string(activeOut)) == "active"
+	return enabled, active, nil
+}
+
+// Checksum returns the hex-encoded SHA-256 of content.
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// FileChecksum returns the SHA-256 of a file and whether the file exists.
+func FileChecksum(ctx context.Context, path string) (string, bool, error) {
+	content, err := ExecutorFrom(ctx).ReadFile(ctx, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Checksum(content), true, nil
+}
+
+// ListeningAddresses returns the local TCP addresses listening on a port,
+// e.g. "0.0.0.0:8200".
+func ListeningAddresses(ctx context.Context, port int) ([]string, error) {
+	output, err := CommandOutput(ctx, "ss", "-Hltn")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening sockets: %w", err)
+	}
+
+	suffix := fmt.Sprintf(":%d", port)
+	var addresses []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// State Recv-Q Send-Q Local-Address:Port Peer-Address:Port
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if strings.HasSuffix(fields[3], suffix) {
+			addresses = append(addresses, fields[3])
+		}
+	}
+	return addresses, scanner.Err()
+}
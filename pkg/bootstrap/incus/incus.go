@@ -1,40 +1,93 @@
 package incus
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 )
 
-// InstallAndConfigureIncus installs and configures Incus.
-func InstallAndConfigureIncus(goroutineName string, dryRun bool) error {
+const (
+	ServiceName = "incus"
+	PackageName = "incus"
+)
+
+// IsInitialized reports whether Incus has been initialized, i.e. has at least one storage pool.
+func IsInitialized(ctx context.Context) (bool, error) {
+	output, err := common.CommandOutput(ctx, "sudo", "incus", "storage", "list", "--format", "csv")
+	if err != nil {
+		return false, fmt.Errorf("failed to list Incus storage pools: %w", err)
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
+// InstallAndConfigureIncus installs Incus and brings its configuration in
+// line with the preseed.
+func InstallAndConfigureIncus(ctx context.Context, goroutineName string, dryRun bool, preseed *Preseed) error {
 	log.Info(fmt.Sprintf("%s is starting Incus installation and configuration...", goroutineName), "dry_run", dryRun)
 
 	// Install Incus package
-	packages := []string{"incus"}
-	if err := common.InstallPackages(goroutineName, dryRun, packages); err != nil {
+	packages := []string{PackageName}
+	if err := common.InstallPackages(ctx, goroutineName, dryRun, packages); err != nil {
 		return fmt.Errorf("failed to install Incus package: %w", err)
 	}
 
-	// Initialize Incus (non-interactive)
-	// This command sets up storage pools, networks, etc.
-	log.Info(fmt.Sprintf("%s is initializing Incus (non-interactive)...", goroutineName), "dry_run", dryRun)
-	// A basic non-interactive setup might look like this:
-	// incus init --auto --storage-backend dir --network-address 0.0.0.0 --network-port 8443
-	// A fully automated setup would require more specific flags or a preseed file.
-
-	// Check if Incus is already initialized
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "incus", "info"); err == nil {
-		log.Info(fmt.Sprintf("%s: Incus is already initialized.", goroutineName))
-	} else {
-		log.Info(fmt.Sprintf("%s is running incus init --auto...", goroutineName), "dry_run", dryRun)
-		if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "incus", "init", "--auto"); err != nil {
-			return fmt.Errorf("failed to initialize Incus: %w", err)
-		}
-		log.Info(fmt.Sprintf("%s: Incus initialized.", goroutineName))
+	if err := ConfigureIncus(ctx, goroutineName, dryRun, preseed); err != nil {
+		return err
 	}
 
 	log.Info(fmt.Sprintf("%s: Incus installation and configuration complete.", goroutineName))
 	return nil
 }
+
+// ConfigureIncus enables the Incus service and applies the parts of the
+// preseed that differ from the current Incus configuration, so that repeated
+// runs converge on the same networks, storage pools and profiles.
+func ConfigureIncus(ctx context.Context, goroutineName string, dryRun bool, preseed *Preseed) error {
+	log.Info(fmt.Sprintf("%s is enabling and starting incus service...", goroutineName), "dry_run", dryRun)
+	if err := common.EnsureService(ctx, goroutineName, dryRun, ServiceName, false); err != nil {
+		return fmt.Errorf("failed to enable incus service: %w", err)
+	}
+
+	current, err := CurrentPreseed(ctx)
+	if err != nil {
+		if !dryRun {
+			return err
+		}
+		// On a dry run Incus may not be installed yet; show the whole preseed.
+		log.Warn(fmt.Sprintf("%s: Could not read the current Incus configuration.", goroutineName), "error", err)
+		current = &Preseed{}
+	}
+	diff, changes, err := DiffPreseed(preseed, current)
+	if err != nil {
+		return err
+	}
+	if diff.IsEmpty() {
+		log.Info(fmt.Sprintf("%s: Incus configuration is up to date.", goroutineName))
+		return nil
+	}
+	for _, change := range changes {
+		log.Info(fmt.Sprintf("%s: Incus configuration differs: %s", goroutineName, change))
+	}
+	if err := ApplyPreseed(ctx, goroutineName, dryRun, diff); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("%s: Incus configured.", goroutineName))
+	return nil
+}
+
+// RemoveIncus stops Incus and removes its package. Instances and storage pools
+// under /var/lib/incus are left in place.
+func RemoveIncus(ctx context.Context, goroutineName string, dryRun bool) error {
+	log.Info(fmt.Sprintf("%s is removing Incus...", goroutineName), "dry_run", dryRun)
+	if err := common.DisableService(ctx, goroutineName, dryRun, ServiceName, ServiceName+".socket"); err != nil {
+		return fmt.Errorf("failed to disable incus service: %w", err)
+	}
+	if err := common.RemovePackages(ctx, goroutineName, dryRun, []string{PackageName}); err != nil {
+		return fmt.Errorf("failed to remove Incus package: %w", err)
+	}
+	log.Info(fmt.Sprintf("%s: Incus removed.", goroutineName))
+	return nil
+}
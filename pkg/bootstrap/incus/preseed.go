@@ -0,0 +1,287 @@
+package incus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Preseed is the part of an Incus preseed document slothctl manages: server
+// configuration, networks, storage pools and profiles. Entities and keys it
+// does not declare are left alone.
+type Preseed struct {
+	Config       map[string]string `yaml:"config,omitempty" mapstructure:"config"`
+	Networks     []Network         `yaml:"networks,omitempty" mapstructure:"networks"`
+	StoragePools []StoragePool     `yaml:"storage_pools,omitempty" mapstructure:"storage_pools"`
+	Profiles     []Profile         `yaml:"profiles,omitempty" mapstructure:"profiles"`
+}
+
+// Network is a managed Incus network, such as a bridge.
+type Network struct {
+	Name        string            `yaml:"name" mapstructure:"name"`
+	Type        string            `yaml:"type,omitempty" mapstructure:"type"` // Defaults to bridge
+	Description string            `yaml:"description,omitempty" mapstructure:"description"`
+	Config      map[string]string `yaml:"config,omitempty" mapstructure:"config"`
+}
+
+// StoragePool is an Incus storage pool.
+type StoragePool struct {
+	Name        string            `yaml:"name" mapstructure:"name"`
+	Driver      string            `yaml:"driver" mapstructure:"driver"`
+	Description string            `yaml:"description,omitempty" mapstructure:"description"`
+	Config      map[string]string `yaml:"config,omitempty" mapstructure:"config"`
+}
+
+// Profile is an Incus profile. Its devices are managed whole: a declared
+// device replaces the device of the same name.
+type Profile struct {
+	Name        string                       `yaml:"name" mapstructure:"name"`
+	Description string                       `yaml:"description,omitempty" mapstructure:"description"`
+	Config      map[string]string            `yaml:"config,omitempty" mapstructure:"config"`
+	Devices     map[string]map[string]string `yaml:"devices,omitempty" mapstructure:"devices"`
+}
+
+// DefaultPreseed returns the preseed used when the configuration declares
+// none: an incusbr0 bridge, a dir storage pool named default, and a default
+// profile attaching both to instances.
+func DefaultPreseed() *Preseed {
+	return &Preseed{
+		Networks: []Network{{
+			Name:   "incusbr0",
+			Config: map[string]string{"ipv4.address": "auto", "ipv6.address": "auto"},
+		}},
+		StoragePools: []StoragePool{{Name: "default", Driver: "dir"}},
+		Profiles: []Profile{{
+			Name: "default",
+			Devices: map[string]map[string]string{
+				"eth0": {"name": "eth0", "network": "incusbr0", "type": "nic"},
+				"root": {"path": "/", "pool": "default", "type": "disk"},
+			},
+		}},
+	}
+}
+
+// IsEmpty reports whether the preseed declares nothing.
+func (p *Preseed) IsEmpty() bool {
+	return len(p.Config) == 0 && len(p.Networks) == 0 && len(p.StoragePools) == 0 && len(p.Profiles) == 0
+}
+
+// Render returns the preseed as the YAML document read by 'incus admin init --preseed'.
+func (p *Preseed) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(p); err != nil {
+		return nil, fmt.Errorf("failed to render Incus preseed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParsePreseed parses a preseed document, such as the output of
+// 'incus admin init --dump'. Sections slothctl does not manage are ignored.
+func ParsePreseed(data []byte) (*Preseed, error) {
+	var p Preseed
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse Incus preseed: %w", err)
+	}
+	return &p, nil
+}
+
+// CurrentPreseed returns the host's current Incus configuration as a preseed.
+func CurrentPreseed(ctx context.Context) (*Preseed, error) {
+	output, err := common.CommandOutput(ctx, "sudo", "incus", "admin", "init", "--dump")
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump Incus configuration: %w", err)
+	}
+	return ParsePreseed(output)
+}
+
+// DiffPreseed returns the part of desired that current does not match yet,
+// as a preseed that 'incus admin init --preseed' merges into the existing
+// configuration, along with a description of each difference. Only the keys
+// desired declares are compared, and "auto" is matched by any address Incus
+// picked. It fails if an existing network or pool would change type.
+func DiffPreseed(desired, current *Preseed) (*Preseed, []string, error) {
+	diff := &Preseed{}
+	var changes []string
+
+	if config, changed := diffConfig(desired.Config, current.Config); len(config) > 0 {
+		diff.Config = config
+		changes = append(changes, describe("server config", changed)...)
+	}
+
+	for _, want := range desired.Networks {
+		got, found := findNetwork(current.Networks, want.Name)
+		if !found {
+			diff.Networks = append(diff.Networks, want)
+			changes = append(changes, fmt.Sprintf("network %s: create", want.Name))
+			continue
+		}
+		if want.Type != "" && got.Type != "" && want.Type != got.Type {
+			return nil, nil, fmt.Errorf("network %s is of type %s, not %s; delete it to change its type", want.Name, got.Type, want.Type)
+		}
+		update := Network{Name: want.Name, Type: got.Type}
+		config, changed := diffConfig(want.Config, got.Config)
+		update.Config = config
+		if want.Description != "" && want.Description != got.Description {
+			update.Description = want.Description
+			changed = append(changed, fmt.Sprintf("description %q -> %q", got.Description, want.Description))
+		}
+		if len(changed) > 0 {
+			diff.Networks = append(diff.Networks, update)
+			changes = append(changes, describe("network "+want.Name, changed)...)
+		}
+	}
+
+	for _, want := range desired.StoragePools {
+		got, found := findStoragePool(current.StoragePools, want.Name)
+		if !found {
+			diff.StoragePools = append(diff.StoragePools, want)
+			changes = append(changes, fmt.Sprintf("storage pool %s: create (%s)", want.Name, want.Driver))
+			continue
+		}
+		if want.Driver != got.Driver {
+			return nil, nil, fmt.Errorf("storage pool %s uses driver %s, not %s; delete it to change its driver", want.Name, got.Driver, want.Driver)
+		}
+		update := StoragePool{Name: want.Name, Driver: got.Driver}
+		config, changed := diffConfig(want.Config, got.Config)
+		update.Config = config
+		if want.Description != "" && want.Description != got.Description {
+			update.Description = want.Description
+			changed = append(changed, fmt.Sprintf("description %q -> %q", got.Description, want.Description))
+		}
+		if len(changed) > 0 {
+			diff.StoragePools = append(diff.StoragePools, update)
+			changes = append(changes, describe("storage pool "+want.Name, changed)...)
+		}
+	}
+
+	for _, want := range desired.Profiles {
+		got, found := findProfile(current.Profiles, want.Name)
+		if !found {
+			diff.Profiles = append(diff.Profiles, want)
+			changes = append(changes, fmt.Sprintf("profile %s: create", want.Name))
+			continue
+		}
+		update := Profile{Name: want.Name}
+		config, changed := diffConfig(want.Config, got.Config)
+		update.Config = config
+		if want.Description != "" && want.Description != got.Description {
+			update.Description = want.Description
+			changed = append(changed, fmt.Sprintf("description %q -> %q", got.Description, want.Description))
+		}
+		for _, name := range sortedKeys(want.Devices) {
+			if _, deviceChanged := diffConfig(want.Devices[name], got.Devices[name]); len(deviceChanged) == 0 && got.Devices[name] != nil {
+				continue
+			}
+			if update.Devices == nil {
+				update.Devices = make(map[string]map[string]string)
+			}
+			update.Devices[name] = want.Devices[name]
+			if got.Devices[name] == nil {
+				changed = append(changed, fmt.Sprintf("device %s: add", name))
+			} else {
+				changed = append(changed, fmt.Sprintf("device %s: replace", name))
+			}
+		}
+		if len(changed) > 0 {
+			diff.Profiles = append(diff.Profiles, update)
+			changes = append(changes, describe("profile "+want.Name, changed)...)
+		}
+	}
+
+	return diff, changes, nil
+}
+
+// ApplyPreseed feeds a preseed to 'incus admin init', which creates missing
+// entities and merges the declared keys into existing ones.
+func ApplyPreseed(ctx context.Context, goroutineName string, dryRun bool, preseed *Preseed) error {
+	document, err := preseed.Render()
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("%s is applying Incus preseed:\n%s", goroutineName, document), "dry_run", dryRun)
+	if err := common.RunCommand(ctx, goroutineName, dryRun, bytes.NewReader(document), "sudo", "incus", "admin", "init", "--preseed"); err != nil {
+		return fmt.Errorf("failed to apply Incus preseed: %w", err)
+	}
+	return nil
+}
+
+// diffConfig returns the desired keys whose current value differs, and a
+// description of each.
+func diffConfig(desired, current map[string]string) (map[string]string, []string) {
+	var diff map[string]string
+	var changed []string
+	for _, key := range sortedKeys(desired) {
+		want, got := desired[key], current[key]
+		if want == got || (want == "auto" && got != "" && got != "none") {
+			continue
+		}
+		if diff == nil {
+			diff = make(map[string]string)
+		}
+		diff[key] = want
+		changed = append(changed, fmt.Sprintf("%s %q -> %q", key, got, want))
+	}
+	return diff, changed
+}
+
+// describe prefixes each change with the entity it belongs to.
+func describe(entity string, changed []string) []string {
+	described := make([]string, len(changed))
+	for i, change := range changed {
+		described[i] = entity + ": " + change
+	}
+	return described
+}
+
+func findNetwork(networks []Network, name string) (Network, bool) {
+	for _, network := range networks {
+		if network.Name == name {
+			return network, true
+		}
+	}
+	return Network{}, false
+}
+
+func findStoragePool(pools []StoragePool, name string) (StoragePool, bool) {
+	for _, pool := range pools {
+		if pool.Name == name {
+			return pool, true
+		}
+	}
+	return StoragePool{}, false
+}
+
+func findProfile(profiles []Profile, name string) (Profile, bool) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// sortedKeys returns the keys of a map in order, so diffs are stable.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Summary describes preseed differences on one line, e.g. for a plan.
+func Summary(changes []string) string {
+	if len(changes) == 0 {
+		return "in sync"
+	}
+	return strings.Join(changes, "; ")
+}
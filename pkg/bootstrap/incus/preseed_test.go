@@ -0,0 +1,140 @@
+package incus
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadDump parses a fixture captured with 'incus admin init --dump'.
+func loadDump(t *testing.T, name string) *Preseed {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ParsePreseed(data)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return current
+}
+
+func TestDiffPreseed(t *testing.T) {
+	defaults := DefaultPreseed()
+	changedConfig := DefaultPreseed()
+	changedConfig.Config = map[string]string{"core.https_address": ":8443"}
+	changedConfig.Networks[0].Config["ipv4.address"] = "10.0.0.1/24"
+	changedConfig.Profiles[0].Description = "Lab profile"
+	bridge := DefaultPreseed().Networks[0]
+	bridge.Type = "bridge"
+
+	tests := []struct {
+		name        string
+		desired     *Preseed
+		dump        string
+		wantDiff    *Preseed
+		wantChanges []string
+		wantErr     string
+	}{
+		{
+			name:    "default on a fresh install",
+			desired: defaults,
+			dump:    "dump-fresh.yaml",
+			wantDiff: &Preseed{
+				Networks:     defaults.Networks,
+				StoragePools: defaults.StoragePools,
+				Profiles:     []Profile{{Name: "default", Devices: defaults.Profiles[0].Devices}},
+			},
+			wantChanges: []string{
+				"network incusbr0: create",
+				"storage pool default: create (dir)",
+				"profile default: device eth0: add",
+				"profile default: device root: add",
+			},
+		},
+		{
+			name:     "default already applied",
+			desired:  defaults,
+			dump:     "dump-default.yaml",
+			wantDiff: &Preseed{},
+		},
+		{
+			name:    "changed config",
+			desired: changedConfig,
+			dump:    "dump-default.yaml",
+			wantDiff: &Preseed{
+				Config:   map[string]string{"core.https_address": ":8443"},
+				Networks: []Network{{Name: "incusbr0", Type: "bridge", Config: map[string]string{"ipv4.address": "10.0.0.1/24"}}},
+				Profiles: []Profile{{Name: "default", Description: "Lab profile"}},
+			},
+			wantChanges: []string{
+				`server config: core.https_address "" -> ":8443"`,
+				`network incusbr0: ipv4.address "10.171.94.1/24" -> "10.0.0.1/24"`,
+				`profile default: description "Default Incus profile" -> "Lab profile"`,
+			},
+		},
+		{
+			name:    "auto does not match none",
+			desired: &Preseed{Networks: defaults.Networks},
+			dump:    "dump-changed.yaml",
+			wantDiff: &Preseed{
+				Networks: []Network{{Name: "incusbr0", Type: "macvlan", Config: map[string]string{"ipv4.address": "auto", "ipv6.address": "auto"}}},
+			},
+			wantChanges: []string{
+				`network incusbr0: ipv4.address "none" -> "auto"`,
+				`network incusbr0: ipv6.address "none" -> "auto"`,
+			},
+		},
+		{
+			name:    "changed device is replaced whole",
+			desired: &Preseed{Profiles: defaults.Profiles},
+			dump:    "dump-changed.yaml",
+			wantDiff: &Preseed{
+				Profiles: []Profile{{Name: "default", Devices: defaults.Profiles[0].Devices}},
+			},
+			wantChanges: []string{
+				"profile default: device eth0: replace",
+				"profile default: device root: add",
+			},
+		},
+		{
+			name:    "storage pool driver change",
+			desired: &Preseed{StoragePools: defaults.StoragePools},
+			dump:    "dump-changed.yaml",
+			wantErr: "storage pool default uses driver zfs, not dir",
+		},
+		{
+			name:    "network type change",
+			desired: &Preseed{Networks: []Network{bridge}},
+			dump:    "dump-changed.yaml",
+			wantErr: "network incusbr0 is of type macvlan, not bridge",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, changes, err := DiffPreseed(tt.desired, loadDump(t, tt.dump))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(diff, tt.wantDiff) {
+				t.Errorf("diff = %+v, want %+v", diff, tt.wantDiff)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("changes = %q, want %q", changes, tt.wantChanges)
+			}
+			if diff.IsEmpty() != (len(changes) == 0) {
+				t.Errorf("diff.IsEmpty() = %v with %d changes", diff.IsEmpty(), len(changes))
+			}
+		})
+	}
+}
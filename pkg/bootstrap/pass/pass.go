@@ -1,22 +1,30 @@
 package pass
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 )
 
+// StoreDir returns the password store of the current user.
+func StoreDir() string {
+	return filepath.Join(os.ExpandEnv("$HOME"), ".password-store")
+}
+
 // InstallAndConfigurePass installs and configures GNU Pass.
-func InstallAndConfigurePass(goroutineName string, dryRun bool) error {
+func InstallAndConfigurePass(ctx context.Context, goroutineName string, dryRun bool) error {
 	log.Info(fmt.Sprintf("%s is starting GNU Pass installation and configuration...", goroutineName), "dry_run", dryRun)
 
 	// Install pass and gnupg packages
 	packages := []string{"pass", "gnupg"}
-	if err := common.InstallPackages(goroutineName, dryRun, packages); err != nil {
+	if err := common.InstallPackages(ctx, goroutineName, dryRun, packages); err != nil {
 		return fmt.Errorf("failed to install pass/gnupg packages: %w", err)
 	}
 
@@ -24,13 +32,13 @@ func InstallAndConfigurePass(goroutineName string, dryRun bool) error {
 	log.Info(fmt.Sprintf("%s is checking for existing GPG key...", goroutineName), "dry_run", dryRun)
 	// This is a simplified check. A real check would parse `gpg --list-keys` output.
 	// For dry-run, we just log the command.
-	if err := common.RunCommand(goroutineName, dryRun, nil, "gpg", "--list-keys"); err != nil {
+	if err := common.RunCommand(ctx, goroutineName, dryRun, nil, "gpg", "--list-keys"); err != nil {
 		log.Warn(fmt.Sprintf("%s: No GPG key found. You might need to generate one manually or automate it.", goroutineName))
 		log.Warn(fmt.Sprintf("%s: Example: gpg --full-generate-key", goroutineName))
 	}
 
 	// Initialize pass repository
-	passDir := filepath.Join(os.ExpandEnv("$HOME"), ".password-store")
+	passDir := StoreDir()
 	if _, err := os.Stat(passDir); os.IsNotExist(err) {
 		log.Info(fmt.Sprintf("%s is initializing pass repository...", goroutineName), "path", passDir, "dry_run", dryRun)
 		// This command requires a GPG key to be present and selected.
@@ -40,7 +48,7 @@ func InstallAndConfigurePass(goroutineName string, dryRun bool) error {
 			log.Info(fmt.Sprintf("%s: Please enter your GPG passphrase if prompted by pass init.", goroutineName))
 			stdin = os.Stdin // Pass os.Stdin for interactive passphrase input
 		}
-		if err := common.RunCommand(goroutineName, dryRun, stdin, "pass", "init", "YOUR_GPG_KEY_ID"); err != nil {
+		if err := common.RunCommand(ctx, goroutineName, dryRun, stdin, "pass", "init", "YOUR_GPG_KEY_ID"); err != nil {
 			return fmt.Errorf("failed to initialize pass repository: %w", err)
 		}
 	} else {
@@ -50,3 +58,41 @@ func InstallAndConfigurePass(goroutineName string, dryRun bool) error {
 	log.Info(fmt.Sprintf("%s: GNU Pass installation and configuration complete.", goroutineName))
 	return nil
 }
+
+// Ready reports whether the password store has been initialized with a GPG
+// key, so that secrets can be inserted into it.
+func Ready() error {
+	if _, err := os.Stat(filepath.Join(StoreDir(), ".gpg-id")); err != nil {
+		return fmt.Errorf("pass store %s is not initialized; run 'pass init <gpg-key-id>': %w", StoreDir(), err)
+	}
+	return nil
+}
+
+// Store keeps secrets in the pass password store, encrypted with its GPG key.
+type Store struct{}
+
+// Insert stores a secret, replacing any secret of the same name.
+func (Store) Insert(ctx context.Context, name, secret string) error {
+	// The secret is passed on stdin so it never appears in the process list or logs.
+	if err := common.RunCommand(ctx, common.GetRandomGoroutineName(), false, strings.NewReader(secret+"\n"), "pass", "insert", "--multiline", "--force", name); err != nil {
+		return fmt.Errorf("failed to store %s in pass: %w", name, err)
+	}
+	return nil
+}
+
+// Show returns a stored secret, or an error wrapping fs.ErrNotExist if there
+// is none by that name.
+func (Store) Show(ctx context.Context, name string) (string, error) {
+	output, err := common.CommandOutput(ctx, "pass", "show", name)
+	if err != nil {
+		if strings.Contains(err.Error(), "is not in the password store") {
+			return "", fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		return "", fmt.Errorf("failed to read %s from pass: %w", name, err)
+	}
+	secret, _, _ := strings.Cut(string(output), "\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty in pass", name)
+	}
+	return secret, nil
+}
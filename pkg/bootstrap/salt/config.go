@@ -0,0 +1,176 @@
+package salt
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+)
+
+// TreeDir is where InstallTree installs the repository's salt/ tree on the
+// master, and where the default configuration serves it from.
+const TreeDir = "/srv/slothctl/salt"
+
+// Config is the Salt configuration of the control plane, read from the salt
+// section of the slothctl configuration. Empty fields take the values of
+// DefaultConfig.
+type Config struct {
+	// GitfsRemotes are git repositories the master serves states from, in
+	// addition to FileRoots.
+	GitfsRemotes []GitfsRemote `mapstructure:"gitfs_remotes"`
+	// FileRoots are the directories of the base environment's states.
+	FileRoots []string `mapstructure:"file_roots"`
+	// PillarRoots are the directories of the base environment's pillar.
+	PillarRoots []string `mapstructure:"pillar_roots"`
+	// ExternalAuth maps PAM users to the functions they may run through the
+	// master's external auth and publisher ACL.
+	ExternalAuth map[string][]string `mapstructure:"external_auth"`
+	// AutoAccept makes the master accept new minion keys without review.
+	AutoAccept bool `mapstructure:"auto_accept"`
+	// MasterAddress is the address minions connect to the master at.
+	MasterAddress string `mapstructure:"master_address"`
+	// MinionID is the minion's ID. Salt uses the host name if it is empty.
+	MinionID string `mapstructure:"minion_id"`
+	// Grains are static grains set on the minion, e.g. roles.
+	Grains map[string][]string `mapstructure:"grains"`
+}
+
+// GitfsRemote is a git repository served by the master's gitfs backend.
+type GitfsRemote struct {
+	URL  string `mapstructure:"url"`
+	Root string `mapstructure:"root"` // Subdirectory holding the states
+	Base string `mapstructure:"base"` // Branch or tag of the base environment
+}
+
+// DefaultConfig returns the configuration of a control plane whose master
+// serves the repository's salt/ tree from TreeDir, with the dedicated Salt
+// user allowed to run everything, and whose minion runs on the same host.
+func DefaultConfig() Config {
+	return Config{
+		FileRoots:     []string{TreeDir, TreeDir + "/formula"},
+		PillarRoots:   []string{TreeDir + "/pillar"},
+		ExternalAuth:  map[string][]string{saltUserName: {".*"}},
+		MasterAddress: "127.0.0.1",
+	}
+}
+
+// WithDefaults returns the configuration with its empty fields set from
+// DefaultConfig.
+func (c Config) WithDefaults() Config {
+	defaults := DefaultConfig()
+	if c.FileRoots == nil {
+		c.FileRoots = defaults.FileRoots
+	}
+	if c.PillarRoots == nil {
+		c.PillarRoots = defaults.PillarRoots
+	}
+	if c.ExternalAuth == nil {
+		c.ExternalAuth = defaults.ExternalAuth
+	}
+	if c.MasterAddress == "" {
+		c.MasterAddress = defaults.MasterAddress
+	}
+	return c
+}
+
+var templateFuncs = template.FuncMap{
+	// quote renders a string as a YAML scalar. JSON strings are valid YAML,
+	// so values need no escaping rules of their own.
+	"quote": func(s string) string {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	},
+}
+
+var masterTemplate = template.Must(template.New("master").Funcs(templateFuncs).Parse(`# Managed by slothctl; local changes are overwritten.
+
+fileserver_backend:
+  - roots
+{{- if .GitfsRemotes}}
+  - git
+
+gitfs_remotes:
+{{- range .GitfsRemotes}}
+  - {{quote .URL}}{{if or .Root .Base}}:
+{{- if .Root}}
+    - root: {{quote .Root}}
+{{- end}}
+{{- if .Base}}
+    - base: {{quote .Base}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+
+file_roots:
+  base:
+{{- range .FileRoots}}
+    - {{quote .}}
+{{- end}}
+
+pillar_roots:
+  base:
+{{- range .PillarRoots}}
+    - {{quote .}}
+{{- end}}
+
+auto_accept: {{if .AutoAccept}}True{{else}}False{{end}}
+{{- if .ExternalAuth}}
+
+# External authentication for Salt Master
+external_auth:
+  pam:
+{{- range $user, $functions := .ExternalAuth}}
+    {{quote $user}}:
+{{- range $functions}}
+      - {{quote .}}
+{{- end}}
+{{- end}}
+
+# ACL for the external auth users
+publisher_acl:
+{{- range $user, $functions := .ExternalAuth}}
+  {{quote $user}}:
+{{- range $functions}}
+    - {{quote .}}
+{{- end}}
+{{- end}}
+{{- end}}
+`))
+
+var minionTemplate = template.Must(template.New("minion").Funcs(templateFuncs).Parse(`# Managed by slothctl; local changes are overwritten.
+
+master: {{quote .MasterAddress}}
+{{- if .MinionID}}
+id: {{quote .MinionID}}
+{{- end}}
+{{- if .Grains}}
+
+grains:
+{{- range $grain, $values := .Grains}}
+  {{quote $grain}}:
+{{- range $values}}
+    - {{quote .}}
+{{- end}}
+{{- end}}
+{{- end}}
+`))
+
+// MasterConfigContent returns the Salt Master configuration written by bootstrap.
+func MasterConfigContent(cfg Config) string {
+	return render(masterTemplate, cfg.WithDefaults())
+}
+
+// MinionConfigContent returns the Salt Minion configuration written by bootstrap.
+func MinionConfigContent(cfg Config) string {
+	return render(minionTemplate, cfg.WithDefaults())
+}
+
+// render executes a configuration template. The templates only format
+// strings into a buffer, so executing them cannot fail.
+func render(t *template.Template, cfg Config) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, cfg); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
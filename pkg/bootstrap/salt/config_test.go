@@ -0,0 +1,99 @@
+package salt
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var goldenConfigs = []struct {
+	name string
+	cfg  Config
+}{
+	{name: "default", cfg: Config{}},
+	{
+		name: "custom",
+		cfg: Config{
+			GitfsRemotes: []GitfsRemote{
+				{URL: "https://github.com/chalkan3/slothctl.git", Root: "salt", Base: "main"},
+				{URL: "https://git.example.com/states.git"},
+			},
+			FileRoots:     []string{"/srv/salt"},
+			PillarRoots:   []string{"/srv/pillar"},
+			ExternalAuth:  map[string][]string{"saltuser": {".*"}, "ops": {"test.ping", "state.apply"}},
+			AutoAccept:    true,
+			MasterAddress: "10.0.0.5",
+			MinionID:      "minion-01",
+			Grains:        map[string][]string{"roles": {"webserver", "database"}, "site": {"lab"}},
+		},
+	},
+	{
+		name: "no-external-auth",
+		cfg:  Config{ExternalAuth: map[string][]string{}},
+	},
+}
+
+func TestConfigGolden(t *testing.T) {
+	for _, tt := range goldenConfigs {
+		for role, render := range map[string]func(Config) string{"master": MasterConfigContent, "minion": MinionConfigContent} {
+			t.Run(tt.name+"/"+role, func(t *testing.T) {
+				got := render(tt.cfg)
+				path := filepath.Join("testdata", tt.name+"-"+role+".golden")
+				if *update {
+					if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("reading golden file (run with -update to create it): %v", err)
+				}
+				if got != string(want) {
+					t.Errorf("%s config does not match %s:\n--- got\n%s\n--- want\n%s", role, path, got, want)
+				}
+			})
+		}
+	}
+}
+
+// remoteExecutor pretends to be a remote host; ConfigureMinion must refuse
+// before running anything on it.
+type remoteExecutor struct{ common.Executor }
+
+func (remoteExecutor) String() string { return "admin@10.0.0.7" }
+
+func TestConfigureMinionRejectsLoopbackMasterOnRemoteHost(t *testing.T) {
+	ctx := common.WithExecutor(context.Background(), remoteExecutor{})
+	for _, address := range []string{"", "127.0.0.1", "localhost", "::1"} {
+		err := ConfigureMinion(ctx, "test", true, Config{MasterAddress: address})
+		if err == nil || !strings.Contains(err.Error(), "salt.master_address") {
+			t.Errorf("master address %q: error = %v, want it to mention salt.master_address", address, err)
+		}
+	}
+}
+
+func TestTreeFilesServedByDefault(t *testing.T) {
+	files, err := TreeFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default file and pillar roots must each hold a top file.
+	for _, name := range []string{"top.sls", "pillar/top.sls"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("built-in salt tree has no %s", name)
+		}
+	}
+	if !ServesTree(Config{}) {
+		t.Errorf("the default configuration does not serve %s", TreeDir)
+	}
+	if ServesTree(Config{FileRoots: []string{"/srv/salt"}, PillarRoots: []string{"/srv/pillar"}}) {
+		t.Errorf("a configuration with its own roots serves %s", TreeDir)
+	}
+}
@@ -1,111 +1,180 @@
 package salt
 
 import (
+	"context"
 	"fmt"
+	"net"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 )
 
 const (
-	saltMasterConfigPath = "/etc/salt/master"
-	saltMinionConfigPath = "/etc/salt/minion"
-	gitFsRepoURL         = "https://github.com/chalkan3/slothctl/salt" // Mock URL
-	saltUserName         = "saltuser"
+	MasterConfigPath  = "/etc/salt/master"
+	MinionConfigPath  = "/etc/salt/minion"
+	MasterServiceName = "salt-master"
+	MinionServiceName = "salt-minion"
+	MasterPackageName = "salt-master" // Both roles share the salt package on Arch; see common.ResolvePackageName
+	MinionPackageName = "salt-minion"
+	saltUserName      = "saltuser"
 )
 
-// InstallAndConfigureSalt installs and configures SaltStack (master and/or minion).
-func InstallAndConfigureSalt(goroutineName string, dryRun bool, isMaster bool, saltUserPassword string) error {
-	log.Info(fmt.Sprintf("%s is starting SaltStack installation and configuration...", goroutineName), "dry_run", dryRun)
-
-	packages := []string{"salt"}
+// Packages returns the Salt packages of a minion, and of a master if isMaster is set.
+func Packages(isMaster bool) []string {
+	packages := []string{MinionPackageName}
 	if isMaster {
-		packages = append(packages, "salt-master")
+		packages = append(packages, MasterPackageName)
+	}
+	return packages
+}
+
+// CreateSaltUser creates the dedicated user that authenticates to the Salt
+// Master's external auth. It returns the user's name.
+func CreateSaltUser(ctx context.Context, goroutineName string, dryRun bool, password string) (string, error) {
+	log.Info(fmt.Sprintf("%s is creating dedicated Salt user...", goroutineName), "username", saltUserName, "dry_run", dryRun)
+	if err := common.CreateUser(ctx, goroutineName, dryRun, saltUserName, password, common.UserOptions{}); err != nil {
+		return "", fmt.Errorf("failed to create Salt user: %w", err)
 	}
+	log.Info(fmt.Sprintf("%s: Dedicated Salt user created.", goroutineName))
+	return saltUserName, nil
+}
+
+// InstallAndConfigureSalt installs and configures SaltStack (master and/or minion).
+func InstallAndConfigureSalt(ctx context.Context, goroutineName string, dryRun bool, isMaster bool, saltUserPassword string, cfg Config) error {
+	log.Info(fmt.Sprintf("%s is starting SaltStack installation and configuration...", goroutineName), "dry_run", dryRun)
 
 	// Install Salt packages
 	// common.InstallPackages already handles dryRun and sudo
-	if err := common.InstallPackages(goroutineName, dryRun, packages); err != nil {
+	if err := common.InstallPackages(ctx, goroutineName, dryRun, Packages(isMaster)); err != nil {
 		return fmt.Errorf("failed to install Salt packages: %w", err)
 	}
 
 	// Create dedicated Salt user if password is provided
 	if saltUserPassword != "" {
-		log.Info(fmt.Sprintf("%s is creating dedicated Salt user...", goroutineName), "username", saltUserName, "dry_run", dryRun)
-		if err := common.CreateUser(goroutineName, dryRun, saltUserName, saltUserPassword); err != nil {
-			return fmt.Errorf("failed to create Salt user: %w", err)
+		if _, err := CreateSaltUser(ctx, goroutineName, dryRun, saltUserPassword); err != nil {
+			return err
 		}
-		log.Info(fmt.Sprintf("%s: Dedicated Salt user created.", goroutineName))
 	}
 
 	// Configure Salt Master (if applicable)
 	if isMaster {
-		log.Info(fmt.Sprintf("%s is configuring Salt Master...", goroutineName), "dry_run", dryRun)
-		masterConfigContent := fmt.Sprintf(`
-fileserver_backend:
-  - roots
-  - git
-
-gitfs_remotes:
-  - %s
-
-# External authentication for Salt Master
-external_auth:
-  pam:
-    %s:
-      - .*
-
-# ACL for the dedicated Salt user
-client_acl:
-  %s:
-    - .*
-
-`, gitFsRepoURL, saltUserName, saltUserName)
-
-		// Use a here-document to write multi-line content to file
-		cmdStr := fmt.Sprintf("cat <<EOF > %s\n%sEOF", saltMasterConfigPath, masterConfigContent)
-		if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "sh", "-c", cmdStr); err != nil {
-			return fmt.Errorf("failed to write Salt Master config: %w", err)
-		}
-		log.Info(fmt.Sprintf("%s: Salt Master configured.", goroutineName))
-
-		// Enable and start salt-master service
-		log.Info(fmt.Sprintf("%s is enabling and starting salt-master service...", goroutineName), "dry_run", dryRun)
-		if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "enable", "salt-master"); err != nil {
-			return fmt.Errorf("failed to enable salt-master service: %w", err)
+		if err := ConfigureMaster(ctx, goroutineName, dryRun, cfg); err != nil {
+			return err
 		}
-		if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "start", "salt-master"); err != nil {
-			return fmt.Errorf("failed to start salt-master service: %w", err)
-		}
-		log.Info(fmt.Sprintf("%s: Salt Master service started.", goroutineName))
 	}
 
 	// Configure Salt Minion
+	if err := ConfigureMinion(ctx, goroutineName, dryRun, cfg); err != nil {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("%s: SaltStack installation and configuration complete.", goroutineName))
+	return nil
+}
+
+// ConfigureMaster writes the Salt Master configuration and makes sure the service
+// is enabled and running. It is restarted only if the configuration changed.
+func ConfigureMaster(ctx context.Context, goroutineName string, dryRun bool, cfg Config) error {
+	log.Info(fmt.Sprintf("%s is configuring Salt Master...", goroutineName), "dry_run", dryRun)
+
+	changed, err := common.EnsureFile(ctx, goroutineName, dryRun, MasterConfigPath, []byte(MasterConfigContent(cfg)), common.ConfigFileOptions)
+	if err != nil {
+		return fmt.Errorf("failed to write Salt Master config: %w", err)
+	}
+	log.Info(fmt.Sprintf("%s: Salt Master configured.", goroutineName))
+
+	// Enable and start salt-master service
+	log.Info(fmt.Sprintf("%s is enabling and starting salt-master service...", goroutineName), "dry_run", dryRun)
+	if err := common.EnsureService(ctx, goroutineName, dryRun, MasterServiceName, changed); err != nil {
+		return fmt.Errorf("failed to start salt-master service: %w", err)
+	}
+	log.Info(fmt.Sprintf("%s: Salt Master service started.", goroutineName))
+	return nil
+}
+
+// ConfigureMinion writes the Salt Minion configuration and makes sure the service
+// is enabled and running. It is restarted only if the configuration changed.
+// A minion on a remote host must be given the master's address, as a loopback
+// address would point it at itself.
+func ConfigureMinion(ctx context.Context, goroutineName string, dryRun bool, cfg Config) error {
 	log.Info(fmt.Sprintf("%s is configuring Salt Minion...", goroutineName), "dry_run", dryRun)
-	minionConfigContent := `
-master: 127.0.0.1 # Assuming master is on the same machine for control-plane
 
-# Optional: Minion ID (defaults to hostname)
-# id: my-minion-id
-`
+	cfg = cfg.WithDefaults()
+	if executor := common.ExecutorFrom(ctx); executor != common.Local && isLoopback(cfg.MasterAddress) {
+		return fmt.Errorf("salt master address %s is not reachable from %s; set salt.master_address in the slothctl configuration", cfg.MasterAddress, executor)
+	}
 
-	// Use a here-document to write multi-line content to file
-	cmdStr := fmt.Sprintf("cat <<EOF > %s\n%sEOF", saltMinionConfigPath, minionConfigContent)
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "sh", "-c", cmdStr); err != nil {
+	changed, err := common.EnsureFile(ctx, goroutineName, dryRun, MinionConfigPath, []byte(MinionConfigContent(cfg)), common.ConfigFileOptions)
+	if err != nil {
 		return fmt.Errorf("failed to write Salt Minion config: %w", err)
 	}
 	log.Info(fmt.Sprintf("%s: Salt Minion configured.", goroutineName))
 
 	// Enable and start salt-minion service
 	log.Info(fmt.Sprintf("%s is enabling and starting salt-minion service...", goroutineName), "dry_run", dryRun)
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "enable", "salt-minion"); err != nil {
-		return fmt.Errorf("failed to enable salt-minion service: %w", err)
-	}
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "start", "salt-minion"); err != nil {
+	if err := common.EnsureService(ctx, goroutineName, dryRun, MinionServiceName, changed); err != nil {
 		return fmt.Errorf("failed to start salt-minion service: %w", err)
 	}
 	log.Info(fmt.Sprintf("%s: Salt Minion service started.", goroutineName))
+	return nil
+}
 
-	log.Info(fmt.Sprintf("%s: SaltStack installation and configuration complete.", goroutineName))
+// isLoopback reports whether address refers to the local host.
+func isLoopback(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// RemoveMaster stops the Salt Master and removes its configuration and package.
+// Where both roles share one package, it is removed only when no minion is
+// enabled on the host.
+func RemoveMaster(ctx context.Context, goroutineName string, dryRun bool) error {
+	return removeRole(ctx, goroutineName, dryRun, saltRole{MasterServiceName, MasterConfigPath, MasterPackageName}, saltRole{MinionServiceName, MinionConfigPath, MinionPackageName})
+}
+
+// RemoveMinion stops the Salt Minion and removes its configuration and package.
+// Where both roles share one package, it is removed only when no master is
+// enabled on the host.
+func RemoveMinion(ctx context.Context, goroutineName string, dryRun bool) error {
+	return removeRole(ctx, goroutineName, dryRun, saltRole{MinionServiceName, MinionConfigPath, MinionPackageName}, saltRole{MasterServiceName, MasterConfigPath, MasterPackageName})
+}
+
+// saltRole is the service, configuration and package of a Salt role.
+type saltRole struct {
+	service    string
+	configPath string
+	pkg        string
+}
+
+// removeRole removes one Salt role, keeping the package if the other role still uses it.
+func removeRole(ctx context.Context, goroutineName string, dryRun bool, role, other saltRole) error {
+	log.Info(fmt.Sprintf("%s is removing %s...", goroutineName, role.service), "dry_run", dryRun)
+	if err := common.DisableService(ctx, goroutineName, dryRun, role.service); err != nil {
+		return fmt.Errorf("failed to disable %s service: %w", role.service, err)
+	}
+	if err := common.RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "rm", "-f", role.configPath); err != nil {
+		return fmt.Errorf("failed to remove %s config: %w", role.service, err)
+	}
+
+	pm, err := common.DetectPackageManager(ctx)
+	if err != nil {
+		return err
+	}
+	shared := common.ResolvePackageName(pm.Name(), role.pkg) == common.ResolvePackageName(pm.Name(), other.pkg)
+	otherEnabled := false
+	if shared {
+		if otherEnabled, _, err = common.ServiceStatus(ctx, other.service); err != nil {
+			return fmt.Errorf("failed to check %s service: %w", other.service, err)
+		}
+	}
+	if otherEnabled {
+		log.Info(fmt.Sprintf("%s: Keeping salt package, %s is still enabled.", goroutineName, other.service))
+	} else if err := common.RemovePackages(ctx, goroutineName, dryRun, []string{role.pkg}); err != nil {
+		return fmt.Errorf("failed to remove Salt package: %w", err)
+	}
+	log.Info(fmt.Sprintf("%s: %s removed.", goroutineName, role.service))
 	return nil
 }
@@ -0,0 +1,112 @@
+package salt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	salttree "github.com/chalkan3/slothctl/salt"
+)
+
+// treeFileOptions are the options for the files of the salt tree. They are
+// not backed up, since the master would serve the backups as states too.
+var treeFileOptions = common.FileOptions{Owner: "root", Group: "root", Mode: 0644}
+
+// TreeFiles returns the files of the repository's salt/ tree built into
+// slothctl, by path relative to TreeDir.
+func TreeFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := fs.WalkDir(salttree.Tree, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := salttree.Tree.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[name] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the built-in salt tree: %w", err)
+	}
+	return files, nil
+}
+
+// TreeHash returns a hash of the salt tree built into slothctl, which changes
+// whenever a file is added, removed or edited.
+func TreeHash() string {
+	files, err := TreeFiles()
+	if err != nil {
+		return ""
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sum := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(sum, "%s\x00%d\x00", name, len(files[name]))
+		sum.Write(files[name])
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// ServesTree reports whether the master configuration serves states or pillar
+// from TreeDir.
+func ServesTree(cfg Config) bool {
+	cfg = cfg.WithDefaults()
+	for _, root := range append(append([]string{}, cfg.FileRoots...), cfg.PillarRoots...) {
+		if root == TreeDir || strings.HasPrefix(root, TreeDir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallTree installs the salt tree built into slothctl in TreeDir and
+// removes the files there that are no longer part of it, so the master serves
+// the states of the slothctl release that bootstrapped it.
+func InstallTree(ctx context.Context, goroutineName string, dryRun bool) error {
+	log.Info(fmt.Sprintf("%s is installing the salt tree...", goroutineName), "dir", TreeDir, "dry_run", dryRun)
+	files, err := TreeFiles()
+	if err != nil {
+		return err
+	}
+
+	for name, content := range files {
+		if _, err := common.EnsureFile(ctx, goroutineName, dryRun, path.Join(TreeDir, name), content, treeFileOptions); err != nil {
+			return fmt.Errorf("failed to install salt tree file %s: %w", name, err)
+		}
+	}
+
+	if _, err := common.ExecutorFrom(ctx).Stat(ctx, TreeDir); errors.Is(err, os.ErrNotExist) {
+		return nil // Only on a dry run, which wrote nothing.
+	}
+	output, err := common.CommandOutput(ctx, "sudo", "find", TreeDir, "-type", "f", "-print0")
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", TreeDir, err)
+	}
+	for _, installed := range bytes.Split(output, []byte{0}) {
+		name := strings.TrimPrefix(string(installed), TreeDir+"/")
+		if _, ok := files[name]; ok || len(installed) == 0 {
+			continue
+		}
+		if err := common.RemoveFile(ctx, goroutineName, dryRun, string(installed), false); err != nil {
+			return fmt.Errorf("failed to remove stale salt tree file %s: %w", name, err)
+		}
+	}
+	log.Info(fmt.Sprintf("%s: Salt tree installed.", goroutineName), "files", len(files))
+	return nil
+}
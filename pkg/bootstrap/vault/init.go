@@ -0,0 +1,160 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+const (
+	// RootTokenSecret is the name the root token is stored under.
+	RootTokenSecret = "slothctl/vault/root-token"
+	// readyTimeout is how long to wait for a starting Vault to answer.
+	readyTimeout = 60 * time.Second
+)
+
+// UnsealKeySecret returns the name the i-th unseal key, counting from 1, is stored under.
+func UnsealKeySecret(i int) string {
+	return fmt.Sprintf("slothctl/vault/unseal-key-%d", i)
+}
+
+// KeyStore keeps the unseal keys and root token, encrypted at rest.
+type KeyStore interface {
+	Insert(ctx context.Context, name, secret string) error
+	// Show returns a stored secret, or an error wrapping fs.ErrNotExist if
+	// there is none by that name.
+	Show(ctx context.Context, name string) (string, error)
+}
+
+// InitOptions are the key shares Vault splits its root key into.
+type InitOptions struct {
+	SecretShares    int `json:"secret_shares"`
+	SecretThreshold int `json:"secret_threshold"` // Number of shares required to unseal
+}
+
+// DefaultInitOptions are Vault's recommended 5 key shares, 3 of them required to unseal.
+var DefaultInitOptions = InitOptions{SecretShares: 5, SecretThreshold: 3}
+
+// InitResponse is the response of Vault's sys/init endpoint.
+type InitResponse struct {
+	Keys      []string `json:"keys"`
+	RootToken string   `json:"root_token"`
+}
+
+// InitVault initializes the Vault server at addr. The response is the only
+// copy of the unseal keys and root token.
+func InitVault(ctx context.Context, addr string, opts InitOptions) (*InitResponse, error) {
+	var resp InitResponse
+	if err := call(ctx, http.MethodPut, addr, "sys/init", opts, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Keys) == 0 || resp.RootToken == "" {
+		return nil, fmt.Errorf("vault sys/init returned no keys")
+	}
+	return &resp, nil
+}
+
+// SubmitUnsealKey submits one unseal key to the Vault server at addr and
+// returns the resulting seal status.
+func SubmitUnsealKey(ctx context.Context, addr, key string) (*SealStatus, error) {
+	var status SealStatus
+	if err := call(ctx, http.MethodPut, addr, "sys/unseal", map[string]string{"key": key}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Initialize initializes the Vault server at addr if it is not initialized
+// yet, stores its unseal keys and root token in keys, and unseals it. A Vault
+// that is already initialized is only unsealed, with the stored keys.
+func Initialize(ctx context.Context, goroutineName string, dryRun bool, addr string, opts InitOptions, keys KeyStore) error {
+	if opts.SecretThreshold < 1 || opts.SecretThreshold > opts.SecretShares {
+		return fmt.Errorf("invalid Vault key threshold %d for %d shares", opts.SecretThreshold, opts.SecretShares)
+	}
+	if dryRun {
+		log.Info(fmt.Sprintf("%s: Dry run: Vault would be initialized and unsealed.", goroutineName), "address", addr, "key_shares", opts.SecretShares, "key_threshold", opts.SecretThreshold)
+		return nil
+	}
+
+	status, err := waitForVault(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if status.Initialized {
+		log.Info(fmt.Sprintf("%s: Vault is already initialized.", goroutineName), "address", addr)
+	} else {
+		log.Info(fmt.Sprintf("%s is initializing Vault...", goroutineName), "address", addr, "key_shares", opts.SecretShares, "key_threshold", opts.SecretThreshold)
+		resp, err := InitVault(ctx, addr, opts)
+		if err != nil {
+			return fmt.Errorf("failed to initialize Vault: %w", err)
+		}
+		// Store the root token first: without it the keys are of little use.
+		if err := keys.Insert(ctx, RootTokenSecret, resp.RootToken); err != nil {
+			return fmt.Errorf("vault is initialized, but storing its root token failed: %w", err)
+		}
+		for i, key := range resp.Keys {
+			if err := keys.Insert(ctx, UnsealKeySecret(i+1), key); err != nil {
+				return fmt.Errorf("vault is initialized, but storing unseal key %d failed: %w", i+1, err)
+			}
+		}
+		log.Info(fmt.Sprintf("%s: Vault initialized; unseal keys and root token stored.", goroutineName), "key_shares", len(resp.Keys))
+	}
+
+	return Unseal(ctx, goroutineName, addr, keys)
+}
+
+// Unseal unseals the Vault server at addr with the unseal keys stored in
+// keys, submitting them one at a time until Vault is unsealed.
+func Unseal(ctx context.Context, goroutineName string, addr string, keys KeyStore) error {
+	status, err := GetSealStatus(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if !status.Initialized {
+		return fmt.Errorf("vault at %s is not initialized", addr)
+	}
+	if !status.Sealed {
+		log.Info(fmt.Sprintf("%s: Vault is already unsealed.", goroutineName), "address", addr)
+		return nil
+	}
+
+	for i := 1; status.Sealed; i++ {
+		key, err := keys.Show(ctx, UnsealKeySecret(i))
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("vault is still sealed after the %d stored unseal keys (%d of %d required)", i-1, status.Progress, status.Threshold)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read unseal key %d: %w", i, err)
+		}
+		if status, err = SubmitUnsealKey(ctx, addr, key); err != nil {
+			return fmt.Errorf("failed to submit unseal key %d: %w", i, err)
+		}
+		log.Info(fmt.Sprintf("%s: Unseal key submitted.", goroutineName), "key", i, "progress", status.Progress, "threshold", status.Threshold)
+	}
+	log.Info(fmt.Sprintf("%s: Vault unsealed.", goroutineName), "address", addr)
+	return nil
+}
+
+// waitForVault waits for a Vault server that may still be starting to answer.
+func waitForVault(ctx context.Context, addr string) (*SealStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		status, err := GetSealStatus(ctx, addr)
+		if err == nil {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("vault did not become ready: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault implements the unauthenticated sys/init, sys/unseal and
+// sys/seal-status endpoints of a Vault server.
+type fakeVault struct {
+	mu          sync.Mutex
+	initialized bool
+	sealed      bool
+	keys        []string
+	threshold   int
+	submitted   map[string]bool
+	initCalls   int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, string) {
+	v := &fakeVault{sealed: true}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+	return v, server.URL
+}
+
+func (v *fakeVault) status() SealStatus {
+	return SealStatus{Initialized: v.initialized, Sealed: v.sealed, Threshold: v.threshold, Shares: len(v.keys), Progress: len(v.submitted)}
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/sys/seal-status":
+		json.NewEncoder(w).Encode(v.status())
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/sys/init":
+		var req InitOptions
+		json.NewDecoder(r.Body).Decode(&req)
+		v.initCalls++
+		if v.initialized {
+			http.Error(w, `{"errors":["Vault is already initialized"]}`, http.StatusBadRequest)
+			return
+		}
+		v.initialized, v.threshold = true, req.SecretThreshold
+		for i := 0; i < req.SecretShares; i++ {
+			v.keys = append(v.keys, fmt.Sprintf("key-%d", i+1))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": v.keys, "keys_base64": v.keys, "root_token": "s.root"})
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/sys/unseal":
+		var req struct{ Key string }
+		json.NewDecoder(r.Body).Decode(&req)
+		valid := false
+		for _, key := range v.keys {
+			valid = valid || key == req.Key
+		}
+		if !valid {
+			http.Error(w, `{"errors":["invalid key"]}`, http.StatusBadRequest)
+			return
+		}
+		if v.submitted == nil {
+			v.submitted = make(map[string]bool)
+		}
+		v.submitted[req.Key] = true
+		if len(v.submitted) >= v.threshold {
+			v.sealed, v.submitted = false, nil
+		}
+		json.NewEncoder(w).Encode(v.status())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// memoryKeyStore is a KeyStore backed by a map.
+type memoryKeyStore map[string]string
+
+func (s memoryKeyStore) Insert(ctx context.Context, name, secret string) error {
+	s[name] = secret
+	return nil
+}
+
+func (s memoryKeyStore) Show(ctx context.Context, name string) (string, error) {
+	secret, ok := s[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	return secret, nil
+}
+
+func TestInitializeStoresKeysAndUnseals(t *testing.T) {
+	v, addr := newFakeVault(t)
+	keys := memoryKeyStore{}
+
+	if err := Initialize(context.Background(), "test", false, addr, InitOptions{SecretShares: 3, SecretThreshold: 2}, keys); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	want := memoryKeyStore{
+		RootTokenSecret:    "s.root",
+		UnsealKeySecret(1): "key-1",
+		UnsealKeySecret(2): "key-2",
+		UnsealKeySecret(3): "key-3",
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("stored keys = %v, want %v", keys, want)
+	}
+	if v.sealed {
+		t.Error("vault is still sealed after Initialize")
+	}
+
+	// A second run leaves the initialized, unsealed Vault alone.
+	if err := Initialize(context.Background(), "test", false, addr, InitOptions{SecretShares: 3, SecretThreshold: 2}, keys); err != nil {
+		t.Fatalf("second Initialize: %v", err)
+	}
+	if v.initCalls != 1 {
+		t.Errorf("sys/init called %d times, want 1", v.initCalls)
+	}
+}
+
+func TestUnsealAfterRestart(t *testing.T) {
+	v, addr := newFakeVault(t)
+	keys := memoryKeyStore{}
+	if err := Initialize(context.Background(), "test", false, addr, DefaultInitOptions, keys); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	v.sealed = true // Vault seals itself when it restarts.
+	if err := Unseal(context.Background(), "test", addr, keys); err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if v.sealed {
+		t.Error("vault is still sealed after Unseal")
+	}
+}
+
+func TestUnsealErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    memoryKeyStore
+		wantErr string
+	}{
+		{
+			name:    "too few stored keys",
+			keys:    memoryKeyStore{UnsealKeySecret(1): "key-1"},
+			wantErr: "still sealed after the 1 stored unseal keys (1 of 3 required)",
+		},
+		{
+			name:    "wrong key",
+			keys:    memoryKeyStore{UnsealKeySecret(1): "not-a-key"},
+			wantErr: "invalid key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, addr := newFakeVault(t)
+			if _, err := InitVault(context.Background(), addr, DefaultInitOptions); err != nil {
+				t.Fatalf("InitVault: %v", err)
+			}
+			err := Unseal(context.Background(), "test", addr, tt.keys)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unseal error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if !v.sealed {
+				t.Error("vault was unsealed")
+			}
+		})
+	}
+}
+
+func TestInitializeRejectsInvalidThreshold(t *testing.T) {
+	_, addr := newFakeVault(t)
+	err := Initialize(context.Background(), "test", false, addr, InitOptions{SecretShares: 2, SecretThreshold: 3}, memoryKeyStore{})
+	if err == nil {
+		t.Fatal("Initialize accepted a threshold above the number of shares")
+	}
+}
@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+)
+
+// DefaultAddress is the address clients on the Vault host use to reach it.
+const DefaultAddress = "https://127.0.0.1:8200"
+
+// Address returns the address of the Vault listener on host, which listens
+// on all interfaces.
+func Address(host string) string {
+	return "https://" + net.JoinHostPort(host, "8200")
+}
+
+// newClient returns an HTTP client for the Vault API at addr. HTTPS servers
+// are verified against the system roots and the CA bundle in $VAULT_CACERT
+// or, if that is not set, the one bootstrap generated on the host of ctx's
+// executor.
+func newClient(ctx context.Context, addr string) (*http.Client, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	if !strings.HasPrefix(addr, "https://") {
+		return client, nil
+	}
+
+	var caPEM []byte
+	var err error
+	if path := os.Getenv("VAULT_CACERT"); path != "" {
+		if caPEM, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read VAULT_CACERT: %w", err)
+		}
+	} else if caPEM, err = common.ExecutorFrom(ctx).ReadFile(ctx, CACertPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read Vault CA bundle: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	roots.AppendCertsFromPEM(caPEM)
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}}
+	return client, nil
+}
+
+// SealStatus is the response of Vault's sys/seal-status and sys/unseal endpoints.
+type SealStatus struct {
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	Threshold   int    `json:"t"`        // Number of unseal keys required
+	Shares      int    `json:"n"`        // Number of unseal keys issued
+	Progress    int    `json:"progress"` // Number of unseal keys submitted so far
+	Version     string `json:"version"`
+}
+
+// GetSealStatus queries the seal status of the Vault server at addr.
+// The endpoint is unauthenticated, so no token is needed.
+func GetSealStatus(ctx context.Context, addr string) (*SealStatus, error) {
+	var status SealStatus
+	if err := call(ctx, http.MethodGet, addr, "sys/seal-status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// call sends a request to the Vault API at addr, encoding body as JSON if it
+// is not nil, and decodes the response into out.
+func call(ctx context.Context, method, addr, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode Vault %s request: %w", path, err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	client, err := newClient(ctx, addr)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, addr+"/v1/"+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Vault at %s: %w", addr, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Vault explains errors in an "errors" list; it never echoes secrets back.
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("vault %s returned status %d: %v", path, resp.StatusCode, apiErr.Errors)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Vault %s response: %w", path, err)
+	}
+	return nil
+}
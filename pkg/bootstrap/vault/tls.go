@@ -0,0 +1,376 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+)
+
+const (
+	TLSDir     = "/etc/vault/tls"
+	CACertPath = TLSDir + "/ca.pem" // CA bundle for clients, readable by everyone
+	CAKeyPath  = TLSDir + "/ca-key.pem"
+	CertPath   = TLSDir + "/vault.pem"
+	KeyPath    = TLSDir + "/vault-key.pem"
+
+	// CAValidity is how long the generated CA is valid.
+	CAValidity = 10 * 365 * 24 * time.Hour
+	// CertValidity is how long a server certificate is valid.
+	CertValidity = 365 * 24 * time.Hour
+	// CertRenewBefore is how long before it expires a server certificate is renewed.
+	CertRenewBefore = 30 * 24 * time.Hour
+)
+
+var (
+	caKeyFileOptions  = common.FileOptions{Owner: "root", Group: "root", Mode: 0600}
+	caCertFileOptions = common.FileOptions{Owner: "root", Group: "root", Mode: 0644}
+	certFileOptions   = common.FileOptions{Owner: "root", Group: "vault", Mode: 0644}
+	keyFileOptions    = common.FileOptions{Owner: "root", Group: "vault", Mode: 0640}
+)
+
+// CertificateStatus describes whether the Vault server certificate needs renewing.
+type CertificateStatus string
+
+const (
+	CertificateValid    CertificateStatus = "valid"
+	CertificateMissing  CertificateStatus = "missing"
+	CertificateExpiring CertificateStatus = "expiring"   // Expires within CertRenewBefore
+	CertificateMismatch CertificateStatus = "mismatched" // Not issued by the CA or not for the host's current addresses
+)
+
+// certificateAuthority is the local CA that issues the Vault server certificate.
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// EnsureTLS makes sure the local CA and a current server certificate for the
+// host's addresses exist, generating the CA on first use. It reports whether
+// the server certificate was (re)issued.
+func EnsureTLS(ctx context.Context, goroutineName string, dryRun bool) (bool, error) {
+	ca, err := loadCA(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info(fmt.Sprintf("%s is generating the Vault CA...", goroutineName), "path", CACertPath, "dry_run", dryRun)
+		if ca, err = generateCA(time.Now()); err != nil {
+			return false, err
+		}
+		keyPEM, err := encodeKey(ca.key)
+		if err != nil {
+			return false, err
+		}
+		if err := common.WriteFileAtomic(ctx, goroutineName, dryRun, CAKeyPath, keyPEM, caKeyFileOptions); err != nil {
+			return false, fmt.Errorf("failed to write Vault CA key: %w", err)
+		}
+		if err := common.WriteFileAtomic(ctx, goroutineName, dryRun, CACertPath, ca.certPEM, caCertFileOptions); err != nil {
+			return false, fmt.Errorf("failed to write Vault CA certificate: %w", err)
+		}
+	} else if err != nil {
+		return false, err
+	}
+	return ensureServerCert(ctx, goroutineName, dryRun, ca, false)
+}
+
+// RotateCertificate issues a new server certificate if the current one is
+// missing, expires within CertRenewBefore or no longer matches the host's
+// addresses, or always with force, and reloads Vault to use it. Vault is
+// reloaded rather than restarted, so it stays unsealed. It reports whether
+// the certificate was rotated.
+func RotateCertificate(ctx context.Context, goroutineName string, dryRun bool, force bool) (bool, error) {
+	ca, err := loadCA(ctx)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("no Vault CA at %s; bootstrap Vault first", CAKeyPath)
+	} else if err != nil {
+		return false, err
+	}
+	if remaining := time.Until(ca.cert.NotAfter); remaining < CertValidity {
+		log.Warn(fmt.Sprintf("%s: The Vault CA expires before a new certificate would.", goroutineName), "ca_expires", ca.cert.NotAfter)
+	}
+
+	rotated, err := ensureServerCert(ctx, goroutineName, dryRun, ca, force)
+	if err != nil || !rotated {
+		return rotated, err
+	}
+	if err := common.Systemctl(ctx, goroutineName, dryRun, "reload", ServiceName); err != nil {
+		return true, fmt.Errorf("certificate rotated, but reloading Vault failed: %w", err)
+	}
+	return true, nil
+}
+
+// GetCertificateStatus checks the server certificate on the host against the
+// CA and the host's current addresses.
+func GetCertificateStatus(ctx context.Context) (CertificateStatus, *x509.Certificate, error) {
+	caPEM, err := common.ExecutorFrom(ctx).ReadFile(ctx, CACertPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return CertificateMissing, nil, nil
+	} else if err != nil {
+		return "", nil, fmt.Errorf("failed to read Vault CA certificate: %w", err)
+	}
+	caCert, err := parseCertificate(caPEM)
+	if err != nil {
+		return "", nil, err
+	}
+	hosts, err := serverHosts(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return certificateStatus(ctx, caCert, hosts, time.Now())
+}
+
+// ensureServerCert issues and writes a server certificate unless the current
+// one is valid and force is not set.
+func ensureServerCert(ctx context.Context, goroutineName string, dryRun bool, ca *certificateAuthority, force bool) (bool, error) {
+	hosts, err := serverHosts(ctx)
+	if err != nil {
+		return false, err
+	}
+	status, cert, err := certificateStatus(ctx, ca.cert, hosts, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if status == CertificateValid && !force {
+		log.Info(fmt.Sprintf("%s: Vault certificate is up to date.", goroutineName), "expires", cert.NotAfter)
+		return false, nil
+	}
+
+	log.Info(fmt.Sprintf("%s is issuing a Vault certificate...", goroutineName), "reason", status, "hosts", strings.Join(hosts, ","), "dry_run", dryRun)
+	certPEM, keyPEM, err := issueServerCert(ca, hosts, time.Now())
+	if err != nil {
+		return false, err
+	}
+	// Write the key first: Vault fails to load a certificate without its key.
+	if err := common.WriteFileAtomic(ctx, goroutineName, dryRun, KeyPath, keyPEM, keyFileOptions); err != nil {
+		return false, fmt.Errorf("failed to write Vault key: %w", err)
+	}
+	if err := common.WriteFileAtomic(ctx, goroutineName, dryRun, CertPath, certPEM, certFileOptions); err != nil {
+		return false, fmt.Errorf("failed to write Vault certificate: %w", err)
+	}
+	return true, nil
+}
+
+// certificateStatus checks the server certificate on the host against the CA
+// and the hosts it must be valid for.
+func certificateStatus(ctx context.Context, caCert *x509.Certificate, hosts []string, now time.Time) (CertificateStatus, *x509.Certificate, error) {
+	certPEM, err := common.ExecutorFrom(ctx).ReadFile(ctx, CertPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return CertificateMissing, nil, nil
+	} else if err != nil {
+		return "", nil, fmt.Errorf("failed to read Vault certificate: %w", err)
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		// A corrupt certificate is replaced like a missing one.
+		log.Warn("Could not parse the Vault certificate", "path", CertPath, "error", err)
+		return CertificateMissing, nil, nil
+	}
+
+	if cert.CheckSignatureFrom(caCert) != nil {
+		return CertificateMismatch, cert, nil
+	}
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return CertificateMismatch, cert, nil
+		}
+	}
+	if now.Add(CertRenewBefore).After(cert.NotAfter) {
+		return CertificateExpiring, cert, nil
+	}
+	return CertificateValid, cert, nil
+}
+
+// serverHosts returns the names and addresses the server certificate is
+// issued for: localhost, the host's name, the addresses of its network
+// interfaces and the address it is reached at.
+func serverHosts(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+
+	hostname, err := common.CommandOutput(ctx, "uname", "-n")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host name: %w", err)
+	}
+	if name := strings.TrimSpace(string(hostname)); name != "" {
+		seen[name] = true
+	}
+
+	output, err := common.CommandOutput(ctx, "ip", "-o", "addr", "show")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host addresses: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		// 2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(fields[3])
+		if err != nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		seen[ip.String()] = true
+	}
+
+	if ip := net.ParseIP(common.ExecutorFrom(ctx).Host()); ip != nil {
+		seen[ip.String()] = true
+	}
+
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// loadCA reads the CA certificate and key from the host. A missing CA is
+// reported with an error matching os.ErrNotExist.
+func loadCA(ctx context.Context) (*certificateAuthority, error) {
+	keyPEM, err := common.ExecutorFrom(ctx).ReadFile(ctx, CAKeyPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read Vault CA key: %w", err)
+	}
+	certPEM, err := common.ExecutorFrom(ctx).ReadFile(ctx, CACertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault CA certificate: %w", err)
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM key in %s", CAKeyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Vault CA key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("vault CA key in %s cannot sign", CAKeyPath)
+	}
+	return &certificateAuthority{cert: cert, certPEM: certPEM, key: signer}, nil
+}
+
+// generateCA creates a new self-signed CA.
+func generateCA(now time.Time) (*certificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "slothctl Vault CA"},
+		NotBefore:             now.Add(-time.Hour), // Tolerate clock skew between hosts
+		NotAfter:              now.Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &certificateAuthority{cert: cert, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key: key}, nil
+}
+
+// issueServerCert issues a server certificate for hosts, which may be names
+// or IP addresses, signed by ca. It returns the certificate followed by the
+// CA certificate, and the key.
+func issueServerCert(ca *certificateAuthority, hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Vault serves the whole chain in the certificate file.
+	var certPEM bytes.Buffer
+	pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM.Write(ca.certPEM)
+	return certPEM.Bytes(), keyPEM, nil
+}
+
+// parseCertificate parses the first certificate of a PEM bundle.
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// encodeKey encodes a private key as PKCS #8 PEM.
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// serialNumber returns a random 128-bit certificate serial number.
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
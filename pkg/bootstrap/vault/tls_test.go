@@ -0,0 +1,187 @@
+package vault
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+)
+
+// tlsHost is a host with a fixed name and addresses, whose files are held in
+// memory.
+type tlsHost struct {
+	common.Executor
+	host  string
+	files map[string][]byte
+}
+
+const ipAddrOutput = `1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host noprefixroute \       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+2: eth0    inet6 fd42::5/64 scope global \       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::1/64 scope link \       valid_lft forever preferred_lft forever
+`
+
+func (h *tlsHost) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	switch name {
+	case "uname":
+		return exec.CommandContext(ctx, "echo", "vault-01")
+	case "ip":
+		return exec.CommandContext(ctx, "printf", "%s", ipAddrOutput)
+	}
+	return exec.CommandContext(ctx, "false")
+}
+
+func (h *tlsHost) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	if data, ok := h.files[path]; ok {
+		return data, nil
+	}
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
+
+func (h *tlsHost) Host() string   { return h.host }
+func (h *tlsHost) String() string { return "tls fixture" }
+
+func newTLSHost(t *testing.T) (context.Context, *tlsHost) {
+	t.Helper()
+	host := &tlsHost{host: "192.0.2.10", files: make(map[string][]byte)}
+	return common.WithExecutor(context.Background(), host), host
+}
+
+func TestServerHosts(t *testing.T) {
+	ctx, _ := newTLSHost(t)
+	hosts, err := serverHosts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Link-local addresses are left out.
+	want := []string{"10.0.0.5", "127.0.0.1", "192.0.2.10", "::1", "fd42::5", "localhost", "vault-01"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("serverHosts() = %v, want %v", hosts, want)
+	}
+}
+
+func TestIssueServerCert(t *testing.T) {
+	ctx, _ := newTLSHost(t)
+	now := time.Now()
+	ca, err := generateCA(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := serverHosts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := issueServerCert(ca, hosts, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(keyPEM), "PRIVATE KEY") {
+		t.Errorf("key is not a PEM private key")
+	}
+	if !strings.HasSuffix(string(certPEM), string(ca.certPEM)) {
+		t.Errorf("certificate file does not end with the CA certificate")
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "vault-01", CurrentTime: now}); err != nil {
+		t.Errorf("certificate does not chain to the generated CA: %v", err)
+	}
+
+	var ips []string
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	sort.Strings(ips)
+	if want := []string{"10.0.0.5", "127.0.0.1", "192.0.2.10", "::1", "fd42::5"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("IP SANs = %v, want %v", ips, want)
+	}
+	if want := []string{"localhost", "vault-01"}; !reflect.DeepEqual(cert.DNSNames, want) {
+		t.Errorf("DNS SANs = %v, want %v", cert.DNSNames, want)
+	}
+	if !cert.NotAfter.Equal(now.Add(CertValidity).Truncate(time.Second)) {
+		t.Errorf("NotAfter = %s, want %s", cert.NotAfter, now.Add(CertValidity))
+	}
+}
+
+func TestCertificateStatus(t *testing.T) {
+	now := time.Now()
+	ca, err := generateCA(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := generateCA(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := []string{"10.0.0.5", "localhost", "vault-01"}
+
+	tests := []struct {
+		name     string
+		ca       *certificateAuthority // Issuer of the installed certificate; nil for none
+		issuedAt time.Time
+		hosts    []string // Hosts the installed certificate was issued for
+		corrupt  bool
+		want     CertificateStatus
+	}{
+		{name: "valid", ca: ca, issuedAt: now, hosts: hosts, want: CertificateValid},
+		{name: "missing", want: CertificateMissing},
+		{name: "corrupt", corrupt: true, want: CertificateMissing},
+		{name: "missing IP SAN", ca: ca, issuedAt: now, hosts: []string{"localhost", "vault-01"}, want: CertificateMismatch},
+		{name: "missing DNS SAN", ca: ca, issuedAt: now, hosts: []string{"10.0.0.5", "localhost"}, want: CertificateMismatch},
+		{name: "issued by another CA", ca: otherCA, issuedAt: now, hosts: hosts, want: CertificateMismatch},
+		{
+			name:     "inside the renewal window",
+			ca:       ca,
+			issuedAt: now.Add(-CertValidity + CertRenewBefore - time.Hour),
+			hosts:    hosts,
+			want:     CertificateExpiring,
+		},
+		{
+			name:     "just outside the renewal window",
+			ca:       ca,
+			issuedAt: now.Add(-CertValidity + CertRenewBefore + time.Hour),
+			hosts:    hosts,
+			want:     CertificateValid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, host := newTLSHost(t)
+			switch {
+			case tt.corrupt:
+				host.files[CertPath] = []byte("not a certificate")
+			case tt.ca != nil:
+				certPEM, _, err := issueServerCert(tt.ca, tt.hosts, tt.issuedAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				host.files[CertPath] = certPEM
+			}
+
+			status, cert, err := certificateStatus(ctx, ca.cert, hosts, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Errorf("status = %s, want %s", status, tt.want)
+			}
+			if (cert != nil) != (tt.ca != nil) {
+				t.Errorf("certificate returned = %v, want %v", cert != nil, tt.ca != nil)
+			}
+		})
+	}
+}
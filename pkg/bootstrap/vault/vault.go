@@ -1,80 +1,119 @@
 package vault
 
 import (
+	"context"
 	"fmt"
-	"path/filepath"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 )
 
 const (
-	vaultConfigPath = "/etc/vault/vault.hcl"
+	ConfigPath      = "/etc/vault/vault.hcl"
+	ListenerAddress = "0.0.0.0:8200"
+	ServiceName     = "vault"
+	PackageName     = "vault"
 	vaultDataPath   = "/opt/vault/data"
 )
 
+// ConfigContent returns the Vault server configuration written by bootstrap.
+func ConfigContent() string {
+	return fmt.Sprintf(`
+storage "file" {
+  path = "%s"
+}
+
+listener "tcp" {
+  address       = "%s"
+  tls_cert_file = "%s"
+  tls_key_file  = "%s"
+}
+
+ui = true
+
+`, vaultDataPath, ListenerAddress, CertPath, KeyPath)
+}
+
 // InstallAndConfigureVault installs and configures HashiCorp Vault.
-func InstallAndConfigureVault(goroutineName string, dryRun bool) error {
+func InstallAndConfigureVault(ctx context.Context, goroutineName string, dryRun bool) error {
 	log.Info(fmt.Sprintf("%s is starting HashiCorp Vault installation and configuration...", goroutineName), "dry_run", dryRun)
 
 	// Install Vault package
 	// Vault is typically distributed as a pre-compiled binary or via a specific repository.
 	// For Arch Linux, it's usually in the community repository.
-	packages := []string{"vault"}
-	if err := common.InstallPackages(goroutineName, dryRun, packages); err != nil {
+	packages := []string{PackageName}
+	if err := common.InstallPackages(ctx, goroutineName, dryRun, packages); err != nil {
 		return fmt.Errorf("failed to install Vault package: %w", err)
 	}
 
+	if err := ConfigureVault(ctx, goroutineName, dryRun); err != nil {
+		return err
+	}
+
+	// Vault starts sealed; Initialize initializes and unseals it.
+
+	log.Info(fmt.Sprintf("%s: HashiCorp Vault installation and configuration complete.", goroutineName))
+	return nil
+}
+
+// ConfigureVault writes the Vault configuration, TLS certificate and data
+// directory, then makes sure the service is enabled and running. It is
+// restarted only if the configuration changed, and reloaded if only the
+// certificate did.
+func ConfigureVault(ctx context.Context, goroutineName string, dryRun bool) error {
 	// Create Vault data directory
 	log.Info(fmt.Sprintf("%s is creating Vault data directory...", goroutineName), "dry_run", dryRun)
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "mkdir", "-p", vaultDataPath); err != nil {
+	if err := common.RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "mkdir", "-p", vaultDataPath); err != nil {
 		return fmt.Errorf("failed to create Vault data directory: %w", err)
 	}
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "chown", "vault:vault", vaultDataPath); err != nil {
+	if err := common.RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "chown", "vault:vault", vaultDataPath); err != nil {
 		return fmt.Errorf("failed to set ownership for Vault data directory: %w", err)
 	}
 
+	// The listener only serves TLS, with a certificate from the local CA.
+	certChanged, err := EnsureTLS(ctx, goroutineName, dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to set up Vault TLS: %w", err)
+	}
+
 	// Configure Vault
 	log.Info(fmt.Sprintf("%s is configuring Vault...", goroutineName), "dry_run", dryRun)
-	vaultConfigContent := fmt.Sprintf(`
-storage "file" {
-  path = "%s"
-}
-
-listener "tcp" {
-  address     = "0.0.0.0:8200"
-  tls_disable = 1
-}
-
-ui = true
 
-`, vaultDataPath)
-
-	// Ensure /etc/vault directory exists
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "mkdir", "-p", filepath.Dir(vaultConfigPath)); err != nil {
-		return fmt.Errorf("failed to create /etc/vault directory: %w", err)
-	}
-
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "sh", "-c", fmt.Sprintf("echo \"%s\" > %s", vaultConfigContent, vaultConfigPath)); err != nil {
+	changed, err := common.EnsureFile(ctx, goroutineName, dryRun, ConfigPath, []byte(ConfigContent()), common.ConfigFileOptions)
+	if err != nil {
 		return fmt.Errorf("failed to write Vault config: %w", err)
 	}
 	log.Info(fmt.Sprintf("%s: Vault configured.", goroutineName))
 
-	// Enable and start vault service
+	// Enable and start vault service, restarting it for a new configuration
 	log.Info(fmt.Sprintf("%s is enabling and starting vault service...", goroutineName), "dry_run", dryRun)
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "enable", "vault"); err != nil {
-		return fmt.Errorf("failed to enable vault service: %w", err)
-	}
-	if err := common.RunCommand(goroutineName, dryRun, nil, "sudo", "systemctl", "start", "vault"); err != nil {
+	if err := common.EnsureService(ctx, goroutineName, dryRun, ServiceName, changed); err != nil {
 		return fmt.Errorf("failed to start vault service: %w", err)
 	}
 	log.Info(fmt.Sprintf("%s: Vault service started.", goroutineName))
 
-	// Note: Vault requires initialization and unsealing after startup.
-	// This is typically a manual or automated process outside of basic installation.
-	// For bootstrapping, you might consider using 'vault operator init' and 'vault operator unseal'
-	// with a simple file backend for development/testing purposes.
+	// A new certificate only needs a reload, which keeps Vault unsealed.
+	if certChanged && !changed {
+		if err := common.Systemctl(ctx, goroutineName, dryRun, "reload", ServiceName); err != nil {
+			return fmt.Errorf("failed to reload vault service: %w", err)
+		}
+	}
+	return nil
+}
 
-	log.Info(fmt.Sprintf("%s: HashiCorp Vault installation and configuration complete.", goroutineName))
+// RemoveVault stops Vault and removes its package and configuration. The data
+// directory is kept, since it holds the encrypted secrets.
+func RemoveVault(ctx context.Context, goroutineName string, dryRun bool) error {
+	log.Info(fmt.Sprintf("%s is removing HashiCorp Vault...", goroutineName), "dry_run", dryRun)
+	if err := common.DisableService(ctx, goroutineName, dryRun, ServiceName); err != nil {
+		return fmt.Errorf("failed to disable vault service: %w", err)
+	}
+	if err := common.RunCommand(ctx, goroutineName, dryRun, nil, "sudo", "rm", "-f", ConfigPath); err != nil {
+		return fmt.Errorf("failed to remove Vault config: %w", err)
+	}
+	if err := common.RemovePackages(ctx, goroutineName, dryRun, []string{PackageName}); err != nil {
+		return fmt.Errorf("failed to remove Vault package: %w", err)
+	}
+	log.Info(fmt.Sprintf("%s: HashiCorp Vault removed; data kept in %s and TLS CA in %s.", goroutineName, vaultDataPath, TLSDir))
 	return nil
 }
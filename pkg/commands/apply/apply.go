@@ -0,0 +1,156 @@
+package apply
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager/manifest"
+	"github.com/spf13/cobra"
+)
+
+// applyCmd represents the 'apply' command
+type applyCmd struct{}
+
+func (c *applyCmd) Parent() string {
+	return ""
+}
+
+func (c *applyCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply [plan-file]",
+		Short: "Converges the system to the resources declared in a manifest",
+		Long: `Reads a YAML or JSON manifest of resources, plans the required changes, applies them and records the resulting state in the embedded database.
+
+When given a plan file saved with 'slothctl plan --out', applies exactly the changes in that plan
+and refuses to run if the recorded or live state changed since the plan was made.
+
+Resources recorded by an earlier apply but no longer in the manifest are deleted from the system.
+Deleting is refused unless --allow-destroy is given.
+
+Ctrl-C stops the apply after the steps that are running, recording the state they left behind.
+Each resource is bounded by its timeout (30m unless the manifest sets one).
+
+With --target-server group:context:name the resources are converged on a registered server over
+SSH instead of the local host, and its state is recorded separately. The server's user must be able to
+run sudo without a password. A saved plan is always applied to the server it was made for.
+
+--on-failure decides what happens when a resource fails: stop (default) starts nothing else,
+continue applies everything that does not depend on the failure and reports every failure, and
+rollback stops and then reverts the changes completed in this run, newest first.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestPath, _ := cmd.Flags().GetString("file")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			parallelism, _ := cmd.Flags().GetInt("parallelism")
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+			allowDestroy, _ := cmd.Flags().GetBool("allow-destroy")
+			noColor, _ := cmd.Flags().GetBool("no-color")
+			onFailure, _ := cmd.Flags().GetString("on-failure")
+			targetServer, _ := cmd.Flags().GetString("target-server")
+
+			failureMode, err := statemanager.ParseFailureMode(onFailure)
+			if err != nil {
+				return err
+			}
+
+			if (manifestPath == "") == (len(args) == 0) {
+				return fmt.Errorf("either a manifest (--file) or a saved plan file is required, but not both")
+			}
+
+			var m *manifest.Manifest
+			var savedPlan *statemanager.SavedPlan
+			if len(args) == 1 {
+				savedPlan, err = statemanager.ReadPlanFile(args[0])
+				if err != nil {
+					return err
+				}
+				m, err = manifest.Parse(savedPlan.Manifest)
+				if err != nil {
+					return fmt.Errorf("invalid manifest in plan file %s: %w", args[0], err)
+				}
+				if cmd.Flags().Changed("target-server") && targetServer != savedPlan.Target {
+					return fmt.Errorf("plan file %s was made for target %q, not %q", args[0], savedPlan.Target, targetServer)
+				}
+				targetServer = savedPlan.Target
+			} else {
+				m, err = manifest.Load(manifestPath)
+				if err != nil {
+					return err
+				}
+			}
+			desiredResources, err := m.BuildResources()
+			if err != nil {
+				return fmt.Errorf("invalid manifest: %w", err)
+			}
+
+			target, err := commands.ResolveTarget(targetServer)
+			if err != nil {
+				return err
+			}
+			if target.Name != "" {
+				log.Info("Converging remote target.", "target", target.Name, "host", target.Executor)
+			}
+
+			sm := statemanager.NewStateManager(target.DatabasePath, dryRun)
+			sm.SetParallelism(parallelism)
+			sm.SetResourceResolver(manifest.ResourceForID)
+			sm.SetAllowDestroy(allowDestroy)
+			sm.SetFailureMode(failureMode)
+
+			ctx, stop := commands.InterruptContext(common.WithExecutor(cmd.Context(), target.Executor))
+			defer stop()
+
+			// Hold the lock across planning (or plan verification) and applying.
+			ctx, err = sm.Lock(ctx, "apply", lockTimeout)
+			if err != nil {
+				return err
+			}
+			defer sm.Unlock()
+
+			var changes []statemanager.Change
+			if savedPlan != nil {
+				if err := sm.VerifyPlan(ctx, savedPlan, desiredResources); err != nil {
+					return err
+				}
+				log.Info("Saved plan matches the current state.", "plan", args[0], "created_at", savedPlan.CreatedAt)
+				changes = savedPlan.Changes
+			} else {
+				changes, err = sm.Plan(ctx, desiredResources)
+				if err != nil {
+					return fmt.Errorf("failed to generate plan: %w", err)
+				}
+			}
+			if noColor {
+				statemanager.RenderChanges(os.Stdout, changes, false)
+			} else {
+				statemanager.PrintChanges(os.Stdout, changes)
+			}
+
+			if err := sm.Apply(ctx, changes, desiredResources); err != nil {
+				return fmt.Errorf("failed to apply changes: %w", err)
+			}
+
+			log.Info("Apply complete.", "total_changes", len(changes), "dry_run", dryRun)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("file", "f", "", "Path to the manifest file")
+	cmd.Flags().Bool("allow-destroy", false, "Allow deleting resources that were removed from the manifest")
+	cmd.Flags().Bool("dry-run", false, "Log the commands that would run without executing them")
+	cmd.Flags().Bool("no-color", false, "Disable colored output")
+	cmd.Flags().String("on-failure", string(statemanager.FailureStop), "What to do when a resource fails: rollback, stop or continue")
+	cmd.Flags().Duration("lock-timeout", 0, "How long to wait for another slothctl run to release the state lock")
+	cmd.Flags().String("target-server", "", "Converge a registered server over SSH, given as group:context:name")
+	cmd.Flags().IntP("parallelism", "p", statemanager.DefaultParallelism, "Maximum number of independent resources to apply concurrently")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&applyCmd{})
+}
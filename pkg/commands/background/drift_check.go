@@ -0,0 +1,181 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/glpi"
+	"github.com/chalkan3/slothctl/pkg/glpimanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager/manifest"
+	"go.etcd.io/bbolt"
+)
+
+// driftChecker plans a manifest and records the drift it finds. Drift that
+// persists for ticketAfter is reported in a GLPI ticket, if ticketAfter is set.
+type driftChecker struct {
+	manifestPath string
+	dbPath       string
+	ticketAfter  time.Duration
+}
+
+// check runs a single drift check. The manifest is read on every check so
+// edits are picked up without restarting the daemon. Checks never take the
+// state lock, so operators never wait for them; a check that overlaps another
+// run records nothing, since that run may be changing what it compares.
+func (d *driftChecker) check(ctx context.Context) error {
+	m, err := manifest.Load(d.manifestPath)
+	if err != nil {
+		return err
+	}
+	resources, err := m.BuildResources()
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", d.manifestPath, err)
+	}
+
+	// Checking for drift never changes the system.
+	sm := statemanager.NewStateManager(d.dbPath, true)
+	sm.SetResourceResolver(manifest.ResourceForID)
+	before, err := lastRunID(sm)
+	if err != nil {
+		return err
+	}
+	changes, err := sm.PlanUnlocked(ctx, resources)
+	if err != nil {
+		return fmt.Errorf("failed to generate plan: %w", err)
+	}
+	if busy, err := stateChanging(sm, before); err != nil || busy {
+		return err
+	}
+
+	records, err := sm.RecordDrift(changes, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		log.Info("Drift check complete, no drift detected.")
+		return nil
+	}
+	for _, record := range records {
+		log.Warn("Drift detected", "id", record.ResourceID, "since", record.FirstSeen, "checks", record.Checks, "properties", record.Properties)
+	}
+
+	if d.ticketAfter > 0 {
+		return d.openTickets(sm, records)
+	}
+	return nil
+}
+
+// lastRunID returns the ID of the last recorded apply, or 0 if there is none.
+func lastRunID(sm *statemanager.StateManager) (uint64, error) {
+	run, err := sm.LastRun()
+	if err != nil || run == nil {
+		return 0, err
+	}
+	return run.ID, nil
+}
+
+// stateChanging reports whether another run holds the state lock, or an apply
+// finished since the run with ID before, in which case the plan of a drift
+// check may mistake its changes for drift.
+func stateChanging(sm *statemanager.StateManager, before uint64) (bool, error) {
+	held, err := sm.CurrentLock()
+	if err != nil {
+		return false, err
+	}
+	if held != nil && !held.Expired(time.Now()) {
+		log.Info("State is locked by another run, skipping drift check.", "holder", held.Holder, "host", held.Host, "operation", held.Operation)
+		return true, nil
+	}
+	after, err := lastRunID(sm)
+	if err != nil {
+		return false, err
+	}
+	if after != before {
+		log.Info("An apply finished during the drift check, skipping it.", "run", after)
+		return true, nil
+	}
+	return false, nil
+}
+
+// openTickets opens a GLPI ticket for every drift that persisted past the
+// threshold and has no ticket yet.
+func (d *driftChecker) openTickets(sm *statemanager.StateManager, records []statemanager.DriftRecord) error {
+	var client *glpi.GLPIClient
+	host, _ := os.Hostname()
+	for _, record := range records {
+		if record.TicketID != 0 || record.Age() < d.ticketAfter {
+			continue
+		}
+		if client == nil {
+			var err error
+			if client, err = d.glpiClient(); err != nil {
+				return fmt.Errorf("failed to get default GLPI client: %w", err)
+			}
+		}
+
+		ticket, err := client.CreateTicket(glpi.TicketInput{
+			Name:    fmt.Sprintf("Drift of %s on %s", record.ResourceID, host),
+			Content: driftTicketContent(record, host),
+			Urgency: 3,
+			Impact:  3,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open ticket for drift of %s: %w", record.ResourceID, err)
+		}
+		if err := sm.SetDriftTicket(record.ResourceID, ticket.ID); err != nil {
+			return err
+		}
+		log.Info("Opened GLPI ticket for persistent drift", "id", record.ResourceID, "ticket_id", ticket.ID)
+	}
+	return nil
+}
+
+// glpiClient authenticates with the default GLPI instance. The database is
+// only held open while the instance is read.
+func (d *driftChecker) glpiClient() (*glpi.GLPIClient, error) {
+	db, err := bbolt.Open(d.dbPath, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open BoltDB: %w", err)
+	}
+	gm := glpimanager.NewManager(db)
+	name, err := gm.GetDefaultGLPIInstance()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	instance, err := gm.GetGLPIInstance(name)
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	client := glpi.NewGLPIClient(instance.URL, instance.AppToken)
+	if err := client.Authenticate(instance.User, instance.Password); err != nil {
+		return nil, fmt.Errorf("failed to authenticate with GLPI instance %s: %w", name, err)
+	}
+	return client, nil
+}
+
+// driftTicketContent describes a drift for a ticket.
+func driftTicketContent(record statemanager.DriftRecord, host string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "slothctl detected that %s on %s no longer matches its last applied state.\n\n", record.ResourceID, host)
+	fmt.Fprintf(&b, "First seen: %s\nLast seen: %s (%d checks)\n\nDrifted properties:\n",
+		record.FirstSeen.Format(time.RFC3339), record.LastSeen.Format(time.RFC3339), record.Checks)
+	keys := make([]string, 0, len(record.Properties))
+	for key := range record.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "- %s: %v\n", key, record.Properties[key])
+	}
+	b.WriteString("\nRun 'slothctl plan' to review the drift and 'slothctl apply' to correct it.\n")
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package background
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -26,31 +28,75 @@ func (c *internalDaemonRunnerCmd) CobraCommand() *cobra.Command {
 		Short:  "(Internal) Runs the background daemon task",
 		Hidden: true, // Hide this command from help output
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Info("Internal daemon runner started.", "pid", os.Getpid())
+			manifestPath, _ := cmd.Flags().GetString("file")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			ticketAfter, _ := cmd.Flags().GetDuration("ticket-after")
+			if manifestPath == "" {
+				return fmt.Errorf("the --file flag is required")
+			}
+			if interval <= 0 {
+				return fmt.Errorf("invalid interval %s: must be positive", interval)
+			}
 
-			// --- Daemon Logic Here ---
-			// This is where your long-running Go function logic goes.
-			// For demonstration, we'll just log a message every few seconds.
+			log.Info("Internal daemon runner started.", "pid", os.Getpid(), "manifest", manifestPath, "interval", interval, "ticket_after", ticketAfter)
+
+			checker := &driftChecker{
+				manifestPath: manifestPath,
+				dbPath:       os.ExpandEnv(config.AppConfig.DatabasePath),
+				ticketAfter:  ticketAfter,
+			}
 
-			// Set up signal handling for graceful shutdown
+			// Set up signal handling for graceful shutdown. A signal also
+			// cancels a drift check in progress.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 			c := make(chan os.Signal, 1)
 			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
 			// Loop indefinitely, or until a stop signal is received
-			for i := 0; ; i++ {
+			for {
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					if err := checker.check(ctx); err != nil {
+						log.Error("Drift check failed", "error", err)
+					}
+				}()
+
 				select {
 				case sig := <-c:
 					log.Info("Received signal, shutting down daemon gracefully.", "signal", sig.String())
+					cancel()
+					<-done
 					return nil // Exit the RunE function, which terminates the process
-				case <-time.After(5 * time.Second):
-					log.Info(fmt.Sprintf("Daemon heartbeat: %d seconds elapsed.", (i+1)*5))
+				case <-done:
+				}
+
+				select {
+				case sig := <-c:
+					log.Info("Received signal, shutting down daemon gracefully.", "signal", sig.String())
+					return nil
+				case <-ticker.C:
 				}
 			}
 		},
 	}
+
+	addDriftFlags(cmd)
 	return cmd
 }
 
+// addDriftFlags adds the drift detection flags shared by 'background-task
+// start' and the daemon runner it launches.
+func addDriftFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "", "Path to the manifest to check for drift (required)")
+	cmd.Flags().Duration("interval", 10*time.Minute, "How often to check for drift")
+	cmd.Flags().Duration("ticket-after", 0, "Open a GLPI ticket on the default instance when drift persists this long (0 disables tickets)")
+}
+
 func init() {
 	commands.AddCommandToRegistry(&internalDaemonRunnerCmd{})
 }
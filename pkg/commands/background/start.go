@@ -24,9 +24,27 @@ func (c *startCmd) Parent() string {
 func (c *startCmd) CobraCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "start",
-		Short: "Starts a Go function in the background as a detached process",
-		Long:  `This command launches a specified Go function as a new, detached process that continues to run after the main CLI command exits.`,
+		Short: "Starts the drift detection daemon in the background as a detached process",
+		Long: `This command launches the drift detection daemon as a new, detached process that continues to run after the main CLI command exits.
+
+The daemon plans the manifest every --interval, records the drift it finds (see 'slothctl drift list') and,
+with --ticket-after, opens a GLPI ticket on the default instance when drift persists that long.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestPath, _ := cmd.Flags().GetString("file")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			ticketAfter, _ := cmd.Flags().GetDuration("ticket-after")
+			if interval <= 0 {
+				return fmt.Errorf("invalid interval %s: must be positive", interval)
+			}
+			// The daemon must find the manifest wherever it is started from.
+			manifestPath, err := filepath.Abs(manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to resolve manifest path: %w", err)
+			}
+			if _, err := os.Stat(manifestPath); err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+
 			log.Info("Attempting to start background task...")
 
 			executable, err := os.Executable()
@@ -36,7 +54,11 @@ func (c *startCmd) CobraCommand() *cobra.Command {
 
 			// Define the command to run the internal daemon runner
 			// We pass a special argument to indicate it's the internal runner
-			commandArgs := []string{"internal-daemon-runner"}
+			commandArgs := []string{"internal-daemon-runner",
+				"--file", manifestPath,
+				"--interval", interval.String(),
+				"--ticket-after", ticketAfter.String(),
+			}
 
 			// Prepare the command
 			proc := exec.Command(executable, commandArgs...)
@@ -83,6 +105,10 @@ func (c *startCmd) CobraCommand() *cobra.Command {
 			return nil
 		},
 	}
+
+	addDriftFlags(cmd)
+	cmd.MarkFlagRequired("file")
+
 	return cmd
 }
 
@@ -0,0 +1,113 @@
+package configure
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/vault"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/config"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// controlPlaneCmd represents the 'configure init control-plane' command
+type controlPlaneCmd struct{}
+
+func (c *controlPlaneCmd) Parent() string {
+	return "init"
+}
+
+func (c *controlPlaneCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "control-plane",
+		Short: "Bootstraps Vault, Incus, Salt and Pass on this host",
+		Long: `Installs and configures the control plane in phases: ` + strings.Join(bootstrap.PhaseNames(), ", ") + `.
+Independent phases run in parallel, and a phase starts once the phases it depends on have completed.
+
+The outcome of each phase is recorded in the embedded database. With --resume, phases that already
+completed with the same inputs are skipped, so a run that failed on a flaky mirror only retries what failed.
+--from-phase runs a phase and every phase after it, and --only-phase runs a single phase; the phases they
+depend on must have completed in an earlier run. Use --list to show the recorded phases.
+
+The vault-init phase initializes Vault with --vault-key-shares unseal keys, --vault-key-threshold of them
+required to unseal it, and stores the keys and the root token in the pass store under slothctl/vault/.
+The pass store must have been initialized with a GPG key.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			resume, _ := cmd.Flags().GetBool("resume")
+			fromPhase, _ := cmd.Flags().GetString("from-phase")
+			onlyPhase, _ := cmd.Flags().GetString("only-phase")
+			passwordEnv, _ := cmd.Flags().GetString("salt-user-password-env")
+			list, _ := cmd.Flags().GetBool("list")
+			keyShares, _ := cmd.Flags().GetInt("vault-key-shares")
+			keyThreshold, _ := cmd.Flags().GetInt("vault-key-threshold")
+
+			store := bootstrap.NewCheckpointStore(os.ExpandEnv(config.AppConfig.DatabasePath))
+			if list {
+				return listPhases(store)
+			}
+
+			opts := bootstrap.Options{
+				DryRun:       dryRun,
+				Resume:       resume,
+				FromPhase:    fromPhase,
+				OnlyPhase:    onlyPhase,
+				VaultInit:    vault.InitOptions{SecretShares: keyShares, SecretThreshold: keyThreshold},
+				IncusPreseed: config.AppConfig.IncusPreseed(),
+				Salt:         config.AppConfig.Salt,
+			}
+			if passwordEnv != "" {
+				opts.SaltUserPassword = os.Getenv(passwordEnv)
+				if opts.SaltUserPassword == "" {
+					return fmt.Errorf("environment variable %s is empty", passwordEnv)
+				}
+				statemanager.RegisterSecret(opts.SaltUserPassword)
+			}
+
+			ctx, stop := commands.InterruptContext(cmd.Context())
+			defer stop()
+			return bootstrap.RunControlPlaneBootstrap(ctx, store, opts)
+		},
+	}
+
+	cmd.Flags().Bool("dry-run", false, "Log the commands that would run without executing them or recording checkpoints")
+	cmd.Flags().Bool("resume", false, "Skip phases that already completed with the same inputs")
+	cmd.Flags().String("from-phase", "", "Run this phase and every phase after it")
+	cmd.Flags().String("only-phase", "", "Run only this phase")
+	cmd.Flags().String("salt-user-password-env", "", "Environment variable to read the dedicated Salt user's password from")
+	cmd.Flags().Int("vault-key-shares", vault.DefaultInitOptions.SecretShares, "Number of unseal keys Vault is initialized with")
+	cmd.Flags().Int("vault-key-threshold", vault.DefaultInitOptions.SecretThreshold, "Number of unseal keys required to unseal Vault")
+	cmd.Flags().Bool("list", false, "List the phases with the outcome of their last run")
+
+	return cmd
+}
+
+// listPhases prints each bootstrap phase with its recorded checkpoint.
+func listPhases(store *bootstrap.CheckpointStore) error {
+	checkpoints, err := store.Checkpoints()
+	if err != nil {
+		return err
+	}
+	for _, phase := range bootstrap.Phases {
+		status := "not run"
+		if checkpoint, ok := checkpoints[phase.Name]; ok {
+			status = fmt.Sprintf("%s %s", checkpoint.Status, checkpoint.FinishedAt.Local().Format(time.RFC3339))
+		}
+		fmt.Printf("%s (%s)\n", phase.Name, status)
+		if len(phase.DependsOn) > 0 {
+			fmt.Printf("      depends on: %s\n", strings.Join(phase.DependsOn, ", "))
+		}
+		if checkpoint, ok := checkpoints[phase.Name]; ok && checkpoint.Error != "" {
+			fmt.Printf("      error: %s\n", checkpoint.Error)
+		}
+	}
+	return nil
+}
+
+func init() {
+	commands.AddCommandToRegistry(&controlPlaneCmd{})
+}
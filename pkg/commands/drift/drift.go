@@ -0,0 +1,30 @@
+package drift
+
+import (
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// driftCmd represents the base command for 'drift'
+type driftCmd struct{}
+
+func (c *driftCmd) Parent() string {
+	return ""
+}
+
+func (c *driftCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Inspect drift found by the background daemon",
+		Long:  `The drift command shows the out-of-band changes that the drift detection daemon ('slothctl background-task start') found on the host.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+		TraverseChildren: true,
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&driftCmd{})
+}
@@ -0,0 +1,78 @@
+package drift
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/config"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the 'drift list' command
+type listCmd struct{}
+
+func (c *listCmd) Parent() string {
+	return "drift"
+}
+
+func (c *listCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the drift detected on this host",
+		Long: `Lists every resource the drift detection daemon found drifted, with when the drift was first and last
+seen, the drifted properties and the GLPI ticket opened for it. Use --all to include drift that was since resolved.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+
+			dbPath := os.ExpandEnv(config.AppConfig.DatabasePath)
+			sm := statemanager.NewStateManager(dbPath, true)
+			records, err := sm.DriftRecords()
+			if err != nil {
+				return err
+			}
+
+			shown := 0
+			for _, record := range records {
+				if !record.Open() && !all {
+					continue
+				}
+				shown++
+				status := "open"
+				if !record.Open() {
+					status = "resolved " + record.ResolvedAt.Local().Format(time.RFC3339)
+				}
+				fmt.Printf("%s (%s, first seen %s, last seen %s, %d checks)\n", record.ResourceID, status,
+					record.FirstSeen.Local().Format(time.RFC3339), record.LastSeen.Local().Format(time.RFC3339), record.Checks)
+				if record.TicketID != 0 {
+					fmt.Printf("      ticket: %d\n", record.TicketID)
+				}
+				keys := make([]string, 0, len(record.Properties))
+				for key := range record.Properties {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					fmt.Printf("      %s: %v\n", key, record.Properties[key])
+				}
+			}
+
+			if shown == 0 {
+				log.Info("No drift detected.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("all", false, "Include drift that has since been resolved")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&listCmd{})
+}
@@ -0,0 +1,14 @@
+package commands
+
+import "fmt"
+
+// ExitError is returned by commands that need a specific process exit code
+// without it being reported as a failure, such as plan signalling pending
+// changes to CI.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
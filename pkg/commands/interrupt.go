@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+// InterruptContext returns a context that is cancelled on the first SIGINT or
+// SIGTERM, so long-running commands can stop cleanly after their current step.
+// After the first signal the default handling is restored, so a second Ctrl-C
+// terminates the process immediately. Call the returned function when done.
+func InterruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.Warn("Interrupted, stopping after the current step. Interrupt again to abort immediately.", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
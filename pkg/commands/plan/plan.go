@@ -0,0 +1,134 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager/manifest"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the 'plan' command
+type planCmd struct{}
+
+func (c *planCmd) Parent() string {
+	return ""
+}
+
+func (c *planCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Shows the changes required to converge a manifest",
+		Long: `Reads a YAML or JSON manifest of resources, compares it with the recorded and live state, and prints the changes that apply would make.
+
+Resources recorded by an earlier apply but no longer in the manifest are planned for deletion.
+
+With --target-server group:context:name the plan is made for a registered server over SSH,
+against the state recorded for that server.
+
+With --json the plan is printed in a stable machine-readable format. With --detailed-exitcode
+the exit code is 0 when there are no changes, 1 on error and 2 when changes are pending.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestPath, _ := cmd.Flags().GetString("file")
+			outPath, _ := cmd.Flags().GetString("out")
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+			jsonOutput, _ := cmd.Flags().GetBool("json")
+			noColor, _ := cmd.Flags().GetBool("no-color")
+			detailedExitCode, _ := cmd.Flags().GetBool("detailed-exitcode")
+			targetServer, _ := cmd.Flags().GetString("target-server")
+
+			m, err := manifest.Load(manifestPath)
+			if err != nil {
+				return err
+			}
+			desiredResources, err := m.BuildResources()
+			if err != nil {
+				return fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+			}
+
+			target, err := commands.ResolveTarget(targetServer)
+			if err != nil {
+				return err
+			}
+
+			// Planning never changes the system.
+			sm := statemanager.NewStateManager(target.DatabasePath, true)
+			sm.SetResourceResolver(manifest.ResourceForID)
+			ctx, stop := commands.InterruptContext(common.WithExecutor(cmd.Context(), target.Executor))
+			defer stop()
+
+			ctx, err = sm.Lock(ctx, "plan", lockTimeout)
+			if err != nil {
+				return err
+			}
+			defer sm.Unlock()
+
+			changes, err := sm.Plan(ctx, desiredResources)
+			if err != nil {
+				return fmt.Errorf("failed to generate plan: %w", err)
+			}
+
+			switch {
+			case jsonOutput:
+				if err := statemanager.WritePlanJSON(os.Stdout, changes); err != nil {
+					return err
+				}
+			case noColor:
+				statemanager.RenderChanges(os.Stdout, changes, false)
+			default:
+				statemanager.PrintChanges(os.Stdout, changes)
+			}
+
+			if outPath != "" {
+				fingerprint, err := sm.Fingerprint(ctx, desiredResources)
+				if err != nil {
+					return fmt.Errorf("failed to fingerprint state: %w", err)
+				}
+				manifestJSON, err := m.JSON()
+				if err != nil {
+					return err
+				}
+				savedPlan := &statemanager.SavedPlan{
+					FormatVersion: statemanager.PlanFormatVersion,
+					CreatedAt:     time.Now().UTC(),
+					Manifest:      manifestJSON,
+					Fingerprint:   fingerprint,
+					Target:        target.Name,
+					Changes:       changes,
+				}
+				if err := statemanager.WritePlanFile(outPath, savedPlan); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Plan saved to %s. Apply it exactly as reviewed with: slothctl apply %s\n", outPath, outPath)
+			}
+			log.Info("Plan complete.", "manifest", manifestPath, "total_changes", len(changes))
+
+			if detailedExitCode && statemanager.Summarize(changes).HasChanges() {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &commands.ExitError{Code: 2}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("file", "f", "", "Path to the manifest file (required)")
+	cmd.Flags().Duration("lock-timeout", 0, "How long to wait for another slothctl run to release the state lock")
+	cmd.Flags().Bool("json", false, "Print the plan in a stable machine-readable JSON format")
+	cmd.Flags().Bool("no-color", false, "Disable colored output")
+	cmd.Flags().Bool("detailed-exitcode", false, "Exit with 0 when there are no changes, 1 on error and 2 when changes are pending")
+	cmd.Flags().StringP("out", "o", "", "Save the plan to this file so it can be reviewed and applied later")
+	cmd.Flags().String("target-server", "", "Plan for a registered server over SSH, given as group:context:name")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&planCmd{})
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// forceUnlockCmd represents the 'state force-unlock' command
+type forceUnlockCmd struct{}
+
+func (c *forceUnlockCmd) Parent() string {
+	return "state"
+}
+
+func (c *forceUnlockCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "force-unlock [lock-id]",
+		Short: "Removes a stale state lock",
+		Long: `Removes the state lock left behind by a crashed or killed slothctl run. Without a lock ID it
+only shows who holds the lock. Only use this when you are sure the holder is no longer running.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, false)
+
+			held, err := sm.CurrentLock()
+			if err != nil {
+				return err
+			}
+			if held == nil {
+				log.Info("State is not locked.")
+				return nil
+			}
+
+			if len(args) == 0 {
+				fmt.Printf("Lock ID: %s\n", held.ID)
+				fmt.Printf("Holder: %s@%s (pid %d)\n", held.Holder, held.Host, held.PID)
+				fmt.Printf("Operation: %s\n", held.Operation)
+				fmt.Printf("Acquired at: %s\n", held.AcquiredAt.Local().Format(time.RFC3339))
+				fmt.Printf("Expires at: %s\n", held.RenewedAt.Add(held.TTL).Local().Format(time.RFC3339))
+				fmt.Println("Run 'slothctl state force-unlock <lock-id>' to remove it.")
+				return nil
+			}
+
+			if err := sm.ForceUnlock(args[0]); err != nil {
+				return fmt.Errorf("failed to force-unlock state: %w", err)
+			}
+			log.Info("State lock removed.", "id", args[0], "holder", held.Holder, "host", held.Host)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&forceUnlockCmd{})
+}
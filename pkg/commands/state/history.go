@@ -0,0 +1,58 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the 'state history' command
+type historyCmd struct{}
+
+func (c *historyCmd) Parent() string {
+	return "state"
+}
+
+func (c *historyCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history [id]",
+		Short: "Shows the recorded versions of a resource",
+		Long:  `Lists every recorded version of a resource with when it was recorded, who ran it, and the changes that produced it.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resourceID := args[0]
+
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, true)
+			history, err := sm.History(resourceID)
+			if err != nil {
+				return err
+			}
+
+			if len(history) == 0 {
+				log.Info("No history recorded.", "id", resourceID)
+				return nil
+			}
+
+			for _, entry := range history {
+				fmt.Printf("[v%d] %s %s by %s@%s\n", entry.Version, entry.Timestamp.Local().Format(time.RFC3339), entry.Operation, entry.User, entry.Host)
+				for _, change := range entry.Changes {
+					fmt.Printf("      %s\n", change.Type)
+				}
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&historyCmd{})
+}
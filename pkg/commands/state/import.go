@@ -0,0 +1,174 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager/manifest"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the 'state import' command
+type importCmd struct{}
+
+func (c *importCmd) Parent() string {
+	return "state"
+}
+
+func (c *importCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [kind] [name]",
+		Short: "Records the state of resources that were set up by hand",
+		Long: `Reads the live state of an existing resource, such as a Vault instance installed by hand, and records
+it as if slothctl had applied it. The host is not changed. Add the resource to your manifest under the same
+kind and name, and the next plan compares against the imported state instead of recreating it.
+
+With --discover, every kind a host runs at most one instance of (vault, incus, salt_master and salt_minion)
+is probed and imported. A kind the manifest given with --file declares is imported under the names it
+declares; any other kind under its default name, e.g. vault:main. A kind that already has a recorded
+resource is skipped, so a Vault recorded as vault:prod is not imported again as vault:main.`,
+		Example: `  slothctl state import vault main
+  slothctl state import user saltuser
+  slothctl state import --discover -f control-plane.yaml`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if discover, _ := cmd.Flags().GetBool("discover"); discover {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			discover, _ := cmd.Flags().GetBool("discover")
+			manifestPath, _ := cmd.Flags().GetString("file")
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+
+			var declared []statemanager.Resource
+			if manifestPath != "" {
+				m, err := manifest.Load(manifestPath)
+				if err != nil {
+					return err
+				}
+				if declared, err = m.BuildResources(); err != nil {
+					return fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+				}
+			}
+
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, false)
+			ctx, err := sm.Lock(common.WithExecutor(cmd.Context(), target.Executor), "import", lockTimeout)
+			if err != nil {
+				return err
+			}
+			defer sm.Unlock()
+
+			var resources []statemanager.Resource
+			if discover {
+				if resources, err = discoverResources(sm, declared); err != nil {
+					return err
+				}
+			} else {
+				res, err := manifest.ResourceForID(args[0] + ":" + args[1])
+				if err != nil {
+					return err
+				}
+				resources = append(resources, res)
+			}
+
+			imported := 0
+			for _, res := range resources {
+				id := res.ID()
+				_, err = sm.Import(ctx, res)
+				switch {
+				case err == nil:
+					imported++
+					fmt.Printf("Imported %s\n", id)
+				case discover && errors.Is(err, statemanager.ErrNotFound):
+					log.Info("Resource not found on this host, skipping", "id", id)
+				case discover && errors.Is(err, statemanager.ErrAlreadyManaged):
+					fmt.Printf("Skipped %s: already recorded\n", id)
+				default:
+					return err
+				}
+			}
+
+			if discover && imported == 0 {
+				log.Info("No unmanaged resources found on this host.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("discover", false, "Probe this host for every discoverable kind and import what is found")
+	cmd.Flags().StringP("file", "f", "", "Manifest whose names discovered resources are imported under")
+	cmd.Flags().Duration("lock-timeout", 0, "How long to wait for another slothctl run to release the state lock")
+
+	return cmd
+}
+
+// discoverResources returns the resources --discover probes for: the
+// resources the manifest declares of each discoverable kind, or the kind's
+// default instance if the manifest declares none. A kind that already has a
+// recorded resource under another name is skipped, so an instance is never
+// recorded twice and then deleted as an orphan.
+func discoverResources(sm *statemanager.StateManager, declared []statemanager.Resource) ([]statemanager.Resource, error) {
+	recorded, err := sm.ListResourceIDs()
+	if err != nil {
+		return nil, err
+	}
+	recordedByKind := make(map[string][]string)
+	for _, id := range recorded {
+		kind, _, _ := strings.Cut(id, ":")
+		recordedByKind[kind] = append(recordedByKind[kind], id)
+	}
+	declaredByKind := make(map[string][]statemanager.Resource)
+	for _, res := range declared {
+		kind, _, _ := strings.Cut(res.ID(), ":")
+		declaredByKind[kind] = append(declaredByKind[kind], res)
+	}
+
+	var resources []statemanager.Resource
+	for _, id := range statemanager.DiscoverableIDs() {
+		kind, _, _ := strings.Cut(id, ":")
+		candidates := declaredByKind[kind]
+		if len(candidates) == 0 {
+			res, err := manifest.ResourceForID(id)
+			if err != nil {
+				return nil, err
+			}
+			candidates = []statemanager.Resource{res}
+		}
+		var undeclared []string
+		for _, recordedID := range recordedByKind[kind] {
+			if !containsID(candidates, recordedID) {
+				undeclared = append(undeclared, recordedID)
+			}
+		}
+		if len(undeclared) > 0 {
+			fmt.Printf("Skipped %s: already recorded as %s\n", kind, strings.Join(undeclared, ", "))
+			continue
+		}
+		resources = append(resources, candidates...)
+	}
+	return resources, nil
+}
+
+// containsID reports whether one of resources has the given ID.
+func containsID(resources []statemanager.Resource, id string) bool {
+	for _, res := range resources {
+		if res.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	commands.AddCommandToRegistry(&importCmd{})
+}
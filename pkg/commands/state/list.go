@@ -0,0 +1,61 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the 'state list' command
+type listCmd struct{}
+
+func (c *listCmd) Parent() string {
+	return "state"
+}
+
+func (c *listCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists all resources with a recorded state",
+		Long:  `Lists every resource recorded in the embedded database, with its latest version and when it was recorded.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, true)
+			ids, err := sm.ListResourceIDs()
+			if err != nil {
+				return err
+			}
+
+			if len(ids) == 0 {
+				log.Info("No resources recorded.")
+				return nil
+			}
+
+			for _, id := range ids {
+				history, err := sm.History(id)
+				if err != nil {
+					return err
+				}
+				if len(history) == 0 {
+					fmt.Printf("%s\n", id)
+					continue
+				}
+				latest := history[len(history)-1]
+				fmt.Printf("%s (v%d, %s by %s@%s)\n", id, latest.Version, latest.Timestamp.Local().Format(time.RFC3339), latest.User, latest.Host)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&listCmd{})
+}
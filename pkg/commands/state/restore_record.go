@@ -0,0 +1,86 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/chalkan3/slothctl/pkg/statemanager/manifest"
+	"github.com/spf13/cobra"
+)
+
+// restoreRecordCmd represents the 'state restore-record' command, also run as
+// 'state rollback'.
+type restoreRecordCmd struct{}
+
+func (c *restoreRecordCmd) Parent() string {
+	return "state"
+}
+
+func (c *restoreRecordCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore-record [id]",
+		Aliases: []string{"rollback"},
+		Short:   "Rolls the recorded state of a resource back to an earlier version",
+		Long: `Makes an earlier version from a resource's history its current recorded state. The restore is
+itself recorded as a new version. 'state rollback' is another name for this command.
+
+Only the record changes; neither the host nor the next plan's changes do. Plans always compare the
+manifest with the live host, and the recorded state only decides whether a change is reported as
+drift. To bring the host back to an earlier configuration, change the manifest and apply it.
+
+A resource that is no longer recorded can only be restored if the manifest given with --file still
+declares it, since the next apply would otherwise delete it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resourceID := args[0]
+			version, _ := cmd.Flags().GetUint64("to")
+			manifestPath, _ := cmd.Flags().GetString("file")
+			lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+
+			if version == 0 {
+				return fmt.Errorf("the --to flag is required")
+			}
+
+			declared := false
+			if manifestPath != "" {
+				m, err := manifest.Load(manifestPath)
+				if err != nil {
+					return err
+				}
+				if declared, err = m.Declares(resourceID); err != nil {
+					return fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+				}
+			}
+
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, false)
+			if _, err := sm.Lock(cmd.Context(), "restore-record", lockTimeout); err != nil {
+				return err
+			}
+			defer sm.Unlock()
+
+			if err := sm.RestoreRecordedState(resourceID, version, declared); err != nil {
+				return fmt.Errorf("failed to restore the record of %s: %w", resourceID, err)
+			}
+
+			log.Info("Recorded state restored.", "id", resourceID, "version", version)
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint64("to", 0, "Version from 'state history' to restore (required)")
+	cmd.Flags().StringP("file", "f", "", "Manifest declaring the resource, if it is no longer recorded")
+	cmd.Flags().Duration("lock-timeout", 0, "How long to wait for another slothctl run to release the state lock")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&restoreRecordCmd{})
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	"github.com/spf13/cobra"
+)
+
+// showCmd represents the 'state show' command
+type showCmd struct{}
+
+func (c *showCmd) Parent() string {
+	return "state"
+}
+
+func (c *showCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [id]",
+		Short: "Shows the recorded state of a resource",
+		Long:  `Prints the recorded state of a resource as JSON. Use --version to show an earlier version from its history.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resourceID := args[0]
+			version, _ := cmd.Flags().GetUint64("version")
+
+			target, err := resolveTarget(cmd)
+			if err != nil {
+				return err
+			}
+			sm := statemanager.NewStateManager(target.DatabasePath, true)
+
+			var state map[string]interface{}
+			if version > 0 {
+				entry, err := sm.StateAtVersion(resourceID, version)
+				if err != nil {
+					return err
+				}
+				state = entry.State
+			} else {
+				var err error
+				state, err = sm.ReadState(resourceID)
+				if err != nil {
+					return err
+				}
+				if state == nil {
+					return fmt.Errorf("no state recorded for %s", resourceID)
+				}
+			}
+
+			encoded, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode state: %w", err)
+			}
+			fmt.Println(string(encoded))
+			return nil
+		},
+	}
+
+	cmd.Flags().Uint64P("version", "v", 0, "Show this version from the history instead of the current state")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&showCmd{})
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// stateCmd represents the base command for 'state'
+type stateCmd struct{}
+
+func (c *stateCmd) Parent() string {
+	return ""
+}
+
+func (c *stateCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect and manage the recorded resource state",
+		Long: `The state command provides tools to list, inspect, import and roll back the resource state that apply records in the embedded database. Rolling back only changes the record, never the host; see 'state rollback --help'.
+
+With --target-server group:context:name the commands work on the state recorded for a registered server.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+		TraverseChildren: true,
+	}
+	cmd.PersistentFlags().String("target-server", "", "Use the state recorded for a registered server, given as group:context:name")
+	return cmd
+}
+
+// resolveTarget resolves the --target-server flag inherited from 'state'.
+func resolveTarget(cmd *cobra.Command) (*commands.Target, error) {
+	spec, _ := cmd.Flags().GetString("target-server")
+	return commands.ResolveTarget(spec)
+}
+
+func init() {
+	commands.AddCommandToRegistry(&stateCmd{})
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/config"
+	"github.com/chalkan3/slothctl/pkg/servermanager"
+	"go.etcd.io/bbolt"
+)
+
+// Target is the host that plan and apply converge: the local host, or a
+// registered server reached over SSH.
+type Target struct {
+	Name         string // group:context:name of the server, empty for the local host
+	Executor     common.Executor
+	DatabasePath string // Database holding the state recorded for the target
+}
+
+// ResolveTarget resolves a --target-server value of the form
+// group:context:name to its registered server. An empty value is the local
+// host. Each server's state is recorded in its own database next to the main
+// one, so resources of different hosts never mix.
+func ResolveTarget(spec string) (*Target, error) {
+	dbPath := os.ExpandEnv(config.AppConfig.DatabasePath)
+	if spec == "" {
+		return &Target{Executor: common.Local, DatabasePath: dbPath}, nil
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid target server %q: expected group:context:name", spec)
+	}
+
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open BoltDB: %w", err)
+	}
+	server, err := servermanager.NewManager(db).GetServer(parts[0], parts[1], parts[2])
+	db.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target server: %w", err)
+	}
+
+	targetDir := filepath.Join(filepath.Dir(dbPath), "targets")
+	if err := os.MkdirAll(targetDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create target state directory: %w", err)
+	}
+	return &Target{
+		Name:         spec,
+		Executor:     common.NewSSHExecutor(server.User, server.IP),
+		DatabasePath: filepath.Join(targetDir, url.PathEscape(spec)+".db"),
+	}, nil
+}
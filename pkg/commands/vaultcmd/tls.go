@@ -0,0 +1,30 @@
+package vaultcmd
+
+import (
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// tlsCmd represents the 'vault tls' command
+type tlsCmd struct{}
+
+func (c *tlsCmd) Parent() string {
+	return "vault"
+}
+
+func (c *tlsCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls",
+		Short: "Manage the TLS certificate of the Vault listener",
+		Long:  `The tls command manages the certificate the Vault listener serves, issued by the local CA that bootstrap generated.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+		TraverseChildren: true,
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&tlsCmd{})
+}
@@ -0,0 +1,59 @@
+package vaultcmd
+
+import (
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/vault"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// tlsRotateCmd represents the 'vault tls rotate' command
+type tlsRotateCmd struct{}
+
+func (c *tlsRotateCmd) Parent() string {
+	return "tls"
+}
+
+func (c *tlsRotateCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Renews the Vault server certificate before it expires",
+		Long: `Issues a new Vault server certificate from the local CA if the current one expires within 30 days or
+no longer covers the host's names and addresses, and reloads Vault to serve it. Reloading keeps Vault
+unsealed. Use --force to rotate a certificate that is still valid.
+
+With --target-server group:context:name the certificate of a registered server is rotated over SSH.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			force, _ := cmd.Flags().GetBool("force")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			targetServer, _ := cmd.Flags().GetString("target-server")
+
+			target, err := commands.ResolveTarget(targetServer)
+			if err != nil {
+				return err
+			}
+			ctx, stop := commands.InterruptContext(common.WithExecutor(cmd.Context(), target.Executor))
+			defer stop()
+
+			rotated, err := vault.RotateCertificate(ctx, common.GetRandomGoroutineName(), dryRun, force)
+			if err != nil {
+				return err
+			}
+			if rotated {
+				log.Info("Vault certificate rotated.", "path", vault.CertPath, "host", target.Executor, "dry_run", dryRun)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("force", false, "Rotate the certificate even if it is still valid")
+	cmd.Flags().Bool("dry-run", false, "Log the commands that would run without executing them")
+	cmd.Flags().String("target-server", "", "Rotate the certificate of a registered server over SSH, given as group:context:name")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&tlsRotateCmd{})
+}
@@ -0,0 +1,38 @@
+package vaultcmd
+
+import (
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/pass"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/vault"
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// unsealCmd represents the 'vault unseal' command
+type unsealCmd struct{}
+
+func (c *unsealCmd) Parent() string {
+	return "vault"
+}
+
+func (c *unsealCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unseal",
+		Short: "Unseals Vault with the keys stored by bootstrap",
+		Long: `Unseals Vault, e.g. after a reboot, with the unseal keys the control plane bootstrap stored in the
+pass store under slothctl/vault/. Keys are submitted one at a time until Vault is unsealed; an unsealed
+Vault is left alone.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			addr, _ := cmd.Flags().GetString("address")
+			return vault.Unseal(cmd.Context(), common.GetRandomGoroutineName(), addr, pass.Store{})
+		},
+	}
+
+	cmd.Flags().String("address", vault.DefaultAddress, "Address of the Vault server")
+
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&unsealCmd{})
+}
@@ -0,0 +1,30 @@
+package vaultcmd
+
+import (
+	"github.com/chalkan3/slothctl/pkg/commands"
+	"github.com/spf13/cobra"
+)
+
+// vaultCmd represents the base command for 'vault'
+type vaultCmd struct{}
+
+func (c *vaultCmd) Parent() string {
+	return ""
+}
+
+func (c *vaultCmd) CobraCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vault",
+		Short: "Operate the control plane's Vault server",
+		Long:  `The vault command provides tools to operate the Vault server set up by the control plane bootstrap.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+		TraverseChildren: true,
+	}
+	return cmd
+}
+
+func init() {
+	commands.AddCommandToRegistry(&vaultCmd{})
+}
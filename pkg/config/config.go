@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 
 	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/incus"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/salt"
 	"github.com/spf13/viper"
 )
 
@@ -15,6 +17,20 @@ type Config struct {
 	AsdfInstallPath string `mapstructure:"asdf_install_path"`
 	// DatabasePath is the path to the embedded database file.
 	DatabasePath string `mapstructure:"database_path"`
+	// Incus declares the storage pools, networks and profiles Incus is
+	// initialized with. The default preseed is used if it is not set.
+	Incus *incus.Preseed `mapstructure:"incus"`
+	// Salt configures the Salt master and minion. Unset fields take their
+	// defaults, see salt.DefaultConfig.
+	Salt salt.Config `mapstructure:"salt"`
+}
+
+// IncusPreseed returns the configured Incus preseed, or the default one.
+func (c Config) IncusPreseed() *incus.Preseed {
+	if c.Incus == nil {
+		return incus.DefaultPreseed()
+	}
+	return c.Incus
 }
 
 // Global configuration instance.
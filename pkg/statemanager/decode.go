@@ -0,0 +1,61 @@
+package statemanager
+
+import "fmt"
+
+// State maps are decoded from JSON, read from the system or built by hand, so
+// resources read them through these helpers instead of unchecked type
+// assertions. A missing key decodes to the zero value; a value of the wrong
+// type is an error rather than a panic.
+
+// StateBool returns a bool value from a state map.
+func StateBool(state map[string]interface{}, key string) (bool, error) {
+	v, ok := state[key]
+	if !ok || v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("state property %q must be a bool, got %T", key, v)
+	}
+	return b, nil
+}
+
+// StateString returns a string value from a state map.
+func StateString(state map[string]interface{}, key string) (string, error) {
+	v, ok := state[key]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("state property %q must be a string, got %T", key, v)
+	}
+	return s, nil
+}
+
+// StateInt returns an integer value from a state map. Numbers decoded from
+// JSON arrive as float64 and are accepted if they are whole.
+func StateInt(state map[string]interface{}, key string) (int, error) {
+	v, ok := state[key]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	i, err := convertAttribute(AttrInt, v)
+	if err != nil {
+		return 0, fmt.Errorf("state property %q %w", key, err)
+	}
+	return i.(int), nil
+}
+
+// StateStrings returns a list of strings from a state map.
+func StateStrings(state map[string]interface{}, key string) ([]string, error) {
+	v, ok := state[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	l, err := convertAttribute(AttrList, v)
+	if err != nil {
+		return nil, fmt.Errorf("state property %q %w", key, err)
+	}
+	return l.([]string), nil
+}
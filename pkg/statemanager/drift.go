@@ -0,0 +1,89 @@
+package statemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// driftedProperties returns the properties whose live value differs from the
+// value recorded at the last apply. A resource that was recorded but no longer
+// exists on the system reports every recorded property as drifted.
+func driftedProperties(lastApplied, live map[string]interface{}) map[string]interface{} {
+	if lastApplied == nil {
+		return nil // Never applied, so nothing can have drifted
+	}
+	lastApplied, live = normalize(lastApplied), normalize(live)
+
+	drift := make(map[string]interface{})
+	for key, recorded := range lastApplied {
+		current, ok := live[key]
+		if !ok {
+			drift[key] = fmt.Sprintf("%v -> (absent)", recorded)
+			continue
+		}
+		if !reflect.DeepEqual(recorded, current) {
+			drift[key] = fmt.Sprintf("%v -> %v", recorded, current)
+		}
+	}
+	return drift
+}
+
+// editedProperties returns the desired properties that differ from the value
+// recorded at the last apply, i.e. the configuration the operator changed.
+func editedProperties(lastApplied, desired map[string]interface{}) map[string]bool {
+	if lastApplied == nil {
+		return nil
+	}
+	lastApplied, desired = normalize(lastApplied), normalize(desired)
+
+	edited := make(map[string]bool)
+	for key, want := range desired {
+		if recorded, ok := lastApplied[key]; !ok || !reflect.DeepEqual(recorded, want) {
+			edited[key] = true
+		}
+	}
+	return edited
+}
+
+// classifyChange sets the origin of a change. A change is drift when the live
+// system moved away from the last-applied state while the desired configuration
+// for the properties the change touches stayed the same.
+func classifyChange(change *Change, lastApplied, drift map[string]interface{}, edited map[string]bool) {
+	if change.Type == ChangeTypeNoOp {
+		return
+	}
+	if lastApplied == nil || len(drift) == 0 {
+		change.Origin = OriginDesired
+		return
+	}
+
+	for _, values := range []map[string]interface{}{change.NewValues, change.OldValues, change.DiffProperties} {
+		for key := range values {
+			if edited[key] {
+				change.Origin = OriginDesired
+				return
+			}
+		}
+	}
+
+	change.Origin = OriginDrift
+	change.DriftProperties = drift
+}
+
+// normalize round-trips a state map through JSON so values read from BoltDB
+// (where numbers become float64) compare equal to values read from the system.
+func normalize(state map[string]interface{}) map[string]interface{} {
+	if state == nil {
+		return map[string]interface{}{}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return state
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return state
+	}
+	return normalized
+}
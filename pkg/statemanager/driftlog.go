@@ -0,0 +1,160 @@
+package statemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// DriftBucket holds the drift found by periodic drift checks, one record per
+// resource.
+const DriftBucket = "slothctl_drift"
+
+// DriftRecord is out-of-band drift of a resource found by a drift check. It is
+// kept after the drift is resolved, until the resource drifts again.
+type DriftRecord struct {
+	ResourceID string                 `json:"resource_id"`
+	FirstSeen  time.Time              `json:"first_seen"`
+	LastSeen   time.Time              `json:"last_seen"`
+	ResolvedAt *time.Time             `json:"resolved_at,omitempty"` // Set by the first check that no longer finds the drift
+	Checks     int                    `json:"checks"`                // Number of checks that found the drift
+	Properties map[string]interface{} `json:"properties"`            // Drifted properties, e.g. "active": "true -> false"
+	TicketID   int                    `json:"ticket_id,omitempty"`   // GLPI ticket opened for the drift, if any
+}
+
+// Open reports whether the drift was still present at the last check.
+func (r *DriftRecord) Open() bool {
+	return r.ResolvedAt == nil
+}
+
+// Age returns how long the drift has persisted.
+func (r *DriftRecord) Age() time.Duration {
+	return r.LastSeen.Sub(r.FirstSeen)
+}
+
+// RecordDrift records the drift changes of a plan made at now. Drift that was
+// already open is extended, and open drift of resources the plan no longer
+// reports as drifted is marked resolved. It returns the open drift records.
+func (sm *StateManager) RecordDrift(changes []Change, now time.Time) ([]DriftRecord, error) {
+	found := make(map[string]map[string]interface{})
+	for _, change := range changes {
+		if change.Origin != OriginDrift {
+			continue
+		}
+		if found[change.ResourceID] == nil {
+			found[change.ResourceID] = make(map[string]interface{})
+		}
+		for key, value := range change.DriftProperties {
+			found[change.ResourceID][key] = value
+		}
+	}
+
+	var open []DriftRecord
+	err := sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(DriftBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		records, err := readDriftRecords(b)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]DriftRecord, len(records))
+		for _, record := range records {
+			existing[record.ResourceID] = record
+		}
+
+		for resourceID, record := range existing {
+			if _, drifted := found[resourceID]; drifted || !record.Open() {
+				continue
+			}
+			resolvedAt := now
+			record.ResolvedAt = &resolvedAt
+			if err := putDriftRecord(b, record); err != nil {
+				return err
+			}
+		}
+		for resourceID, properties := range found {
+			record, ok := existing[resourceID]
+			if !ok || !record.Open() {
+				record = DriftRecord{ResourceID: resourceID, FirstSeen: now}
+			}
+			record.LastSeen = now
+			record.Checks++
+			record.Properties = properties
+			if err := putDriftRecord(b, record); err != nil {
+				return err
+			}
+			open = append(open, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record drift: %w", err)
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].ResourceID < open[j].ResourceID })
+	return open, nil
+}
+
+// DriftRecords returns all drift records, open and resolved, sorted by resource ID.
+func (sm *StateManager) DriftRecords() ([]DriftRecord, error) {
+	var records []DriftRecord
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(DriftBucket))
+		if b == nil {
+			return nil
+		}
+		var err error
+		records, err = readDriftRecords(b)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drift records: %w", err)
+	}
+	return records, nil
+}
+
+// SetDriftTicket records the ticket opened for the open drift of a resource.
+func (sm *StateManager) SetDriftTicket(resourceID string, ticketID int) error {
+	return sm.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(DriftBucket))
+		if b == nil {
+			return fmt.Errorf("no drift recorded for %s", resourceID)
+		}
+		data := b.Get([]byte(resourceID))
+		if data == nil {
+			return fmt.Errorf("no drift recorded for %s", resourceID)
+		}
+		var record DriftRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("unmarshal drift record: %w", err)
+		}
+		record.TicketID = ticketID
+		return putDriftRecord(b, record)
+	})
+}
+
+// readDriftRecords decodes every record in the drift bucket, in key order.
+func readDriftRecords(b *bbolt.Bucket) ([]DriftRecord, error) {
+	var records []DriftRecord
+	err := b.ForEach(func(k, v []byte) error {
+		var record DriftRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("unmarshal drift record %s: %w", k, err)
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func putDriftRecord(b *bbolt.Bucket, record DriftRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal drift record: %w", err)
+	}
+	return b.Put([]byte(record.ResourceID), data)
+}
@@ -0,0 +1,68 @@
+package statemanager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordDriftTransitions(t *testing.T) {
+	const id = "file:/etc/motd"
+	drift := []Change{{
+		Type:            ChangeTypeConfigure,
+		ResourceID:      id,
+		Origin:          OriginDrift,
+		DriftProperties: map[string]interface{}{"checksum": "a -> b"},
+	}}
+	desired := []Change{{Type: ChangeTypeConfigure, ResourceID: id, Origin: OriginDesired}}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	sm := NewStateManager(filepath.Join(t.TempDir(), "state.db"), false)
+	steps := []struct {
+		name          string
+		changes       []Change
+		at            time.Duration
+		wantOpen      bool
+		wantFirstSeen time.Duration
+		wantChecks    int
+		wantResolved  time.Duration // Only checked when the drift is resolved
+	}{
+		{name: "open", changes: drift, at: 0, wantOpen: true, wantFirstSeen: 0, wantChecks: 1},
+		{name: "extend", changes: drift, at: time.Hour, wantOpen: true, wantFirstSeen: 0, wantChecks: 2},
+		{name: "resolve", changes: nil, at: 2 * time.Hour, wantFirstSeen: 0, wantChecks: 2, wantResolved: 2 * time.Hour},
+		{name: "stay resolved", changes: desired, at: 3 * time.Hour, wantFirstSeen: 0, wantChecks: 2, wantResolved: 2 * time.Hour},
+		{name: "reopen", changes: drift, at: 4 * time.Hour, wantOpen: true, wantFirstSeen: 4 * time.Hour, wantChecks: 1},
+	}
+	for _, step := range steps {
+		open, err := sm.RecordDrift(step.changes, start.Add(step.at))
+		if err != nil {
+			t.Fatalf("%s: RecordDrift: %v", step.name, err)
+		}
+		if got := len(open) == 1; got != step.wantOpen {
+			t.Errorf("%s: returned %d open records, want open = %v", step.name, len(open), step.wantOpen)
+		}
+
+		records, err := sm.DriftRecords()
+		if err != nil {
+			t.Fatalf("%s: DriftRecords: %v", step.name, err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("%s: got %d records, want 1", step.name, len(records))
+		}
+		record := records[0]
+		if record.Open() != step.wantOpen {
+			t.Errorf("%s: Open() = %v, want %v", step.name, record.Open(), step.wantOpen)
+		}
+		if want := start.Add(step.wantFirstSeen); !record.FirstSeen.Equal(want) {
+			t.Errorf("%s: FirstSeen = %s, want %s", step.name, record.FirstSeen, want)
+		}
+		if record.Checks != step.wantChecks {
+			t.Errorf("%s: Checks = %d, want %d", step.name, record.Checks, step.wantChecks)
+		}
+		if !step.wantOpen {
+			if want := start.Add(step.wantResolved); record.ResolvedAt == nil || !record.ResolvedAt.Equal(want) {
+				t.Errorf("%s: ResolvedAt = %v, want %s", step.name, record.ResolvedAt, want)
+			}
+		}
+	}
+}
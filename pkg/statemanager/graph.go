@@ -0,0 +1,177 @@
+package statemanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultParallelism is the number of independent resources applied concurrently.
+const DefaultParallelism = 4
+
+// ErrDependencyFailed is returned for resources that were skipped because one of
+// their dependencies failed or was skipped itself.
+var ErrDependencyFailed = errors.New("dependency failed")
+
+// graph is the dependency DAG of a set of resources.
+type graph struct {
+	nodes      map[string]Resource
+	deps       map[string][]string // resource ID -> IDs it depends on
+	dependents map[string][]string // resource ID -> IDs that depend on it
+	order      []string            // Topological order, stable with respect to input order
+	position   map[string]int      // Resource ID -> index in order
+}
+
+// buildGraph builds the dependency graph of the given resources. extraDeps
+// adds dependencies the resources do not declare themselves, such as the
+// order in which orphans are deleted. It fails on unknown dependencies and on
+// cycles.
+func buildGraph(resources []Resource, extraDeps map[string][]string) (*graph, error) {
+	g := &graph{
+		nodes:      make(map[string]Resource),
+		deps:       make(map[string][]string),
+		dependents: make(map[string][]string),
+		position:   make(map[string]int),
+	}
+
+	var ids []string
+	for _, res := range resources {
+		id := res.ID()
+		if _, exists := g.nodes[id]; exists {
+			return nil, fmt.Errorf("duplicate resource %s", id)
+		}
+		g.nodes[id] = res
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		var deps []string
+		if dependent, ok := g.nodes[id].(Dependent); ok {
+			deps = append(deps, dependent.DependsOn()...)
+		}
+		for _, dep := range append(deps, extraDeps[id]...) {
+			if _, exists := g.nodes[dep]; !exists {
+				return nil, fmt.Errorf("resource %s depends on unknown resource %s", id, dep)
+			}
+			if dep == id {
+				return nil, fmt.Errorf("resource %s depends on itself", id)
+			}
+			g.deps[id] = append(g.deps[id], dep)
+			g.dependents[dep] = append(g.dependents[dep], id)
+		}
+	}
+
+	// Depth-first topological sort; a node seen again while still on the stack is a cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int)
+	var stack []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch marks[id] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, s := range stack {
+				if s == id {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, stack[start:]...), id)
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+		marks[id] = visiting
+		stack = append(stack, id)
+		for _, dep := range g.deps[id] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[id] = visited
+		g.position[id] = len(g.order)
+		g.order = append(g.order, id)
+		return nil
+	}
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// walk calls fn for every resource once all of its dependencies succeeded,
+// running up to parallelism calls concurrently. Resources whose dependencies
+// failed are not visited and report ErrDependencyFailed. The returned map holds
+// the outcome of every resource; a nil error means success.
+func (g *graph) walk(parallelism int, fn func(Resource) error) map[string]error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make(map[string]error, len(g.order))
+	pending := make(map[string]int, len(g.order))
+	var ready []string
+	for _, id := range g.order {
+		pending[id] = len(g.deps[id])
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	// resolve records the outcome of a resource and releases or skips its dependents.
+	var resolve func(id string, err error)
+	resolve = func(id string, err error) {
+		results[id] = err
+		for _, dependent := range g.dependents[id] {
+			pending[dependent]--
+			if pending[dependent] > 0 {
+				continue
+			}
+			var failedDep string
+			for _, dep := range g.deps[dependent] {
+				if results[dep] != nil {
+					failedDep = dep
+					break
+				}
+			}
+			if failedDep != "" {
+				resolve(dependent, fmt.Errorf("%w: %s", ErrDependencyFailed, failedDep))
+				continue
+			}
+			ready = append(ready, dependent)
+		}
+		// Keep the ready queue in topological order so sequential runs are deterministic.
+		sort.SliceStable(ready, func(i, j int) bool { return g.position[ready[i]] < g.position[ready[j]] })
+	}
+
+	type outcome struct {
+		id  string
+		err error
+	}
+	finished := make(chan outcome)
+	running := 0
+
+	for len(ready) > 0 || running > 0 {
+		for running < parallelism && len(ready) > 0 {
+			id := ready[0]
+			ready = ready[1:]
+			running++
+			go func(id string) {
+				finished <- outcome{id: id, err: fn(g.nodes[id])}
+			}(id)
+		}
+		done := <-finished
+		running--
+		resolve(done.id, done.err)
+	}
+
+	return results
+}
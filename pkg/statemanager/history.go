@@ -0,0 +1,202 @@
+package statemanager
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// StateBucket holds the latest recorded state of every resource.
+	StateBucket = "slothctl_state"
+	// HistoryBucket holds one nested bucket per resource with every recorded version.
+	HistoryBucket = "slothctl_state_history"
+)
+
+// StateVersion is a single entry in the state history of a resource.
+type StateVersion struct {
+	Version   uint64                 `json:"version"`
+	Timestamp time.Time              `json:"timestamp"`
+	User      string                 `json:"user"`
+	Host      string                 `json:"host"`
+	Operation string                 `json:"operation"` // e.g. "apply" or "restore record v3"
+	Changes   []Change               `json:"changes,omitempty"`
+	State     map[string]interface{} `json:"state"`
+}
+
+// RecordState writes the current state of a resource and appends it to the
+// resource's history, together with the changes that produced it. Registered
+// secrets are stored only as hashes.
+func (sm *StateManager) RecordState(resourceID string, state map[string]interface{}, operation string, changes []Change) error {
+	state = protectState(state, nil)
+	return sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(StateBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("marshal state: %w", err)
+		}
+		if err := b.Put([]byte(resourceID), data); err != nil {
+			return err
+		}
+		return appendHistory(tx, resourceID, state, operation, changes)
+	})
+}
+
+// appendHistory adds a new version to the history of a resource.
+func appendHistory(tx *bbolt.Tx, resourceID string, state map[string]interface{}, operation string, changes []Change) error {
+	history, err := tx.CreateBucketIfNotExists([]byte(HistoryBucket))
+	if err != nil {
+		return fmt.Errorf("create history bucket: %w", err)
+	}
+	b, err := history.CreateBucketIfNotExists([]byte(resourceID))
+	if err != nil {
+		return fmt.Errorf("create history bucket for %s: %w", resourceID, err)
+	}
+	version, err := b.NextSequence()
+	if err != nil {
+		return fmt.Errorf("allocate history version for %s: %w", resourceID, err)
+	}
+
+	host, _ := os.Hostname()
+	entry := StateVersion{
+		Version:   version,
+		Timestamp: time.Now().UTC(),
+		User:      currentUser(),
+		Host:      host,
+		Operation: operation,
+		Changes:   redactChanges(changes),
+		State:     protectState(state, nil),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal history entry: %w", err)
+	}
+	return b.Put(versionKey(version), data)
+}
+
+// ListResourceIDs returns the IDs of all resources with a recorded state.
+func (sm *StateManager) ListResourceIDs() ([]string, error) {
+	var ids []string
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(StateBucket))
+		if b == nil {
+			return nil // No state saved yet
+		}
+		return b.ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recorded resources: %w", err)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// History returns every recorded version of a resource, oldest first.
+func (sm *StateManager) History(resourceID string) ([]StateVersion, error) {
+	var versions []StateVersion
+	err := sm.view(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte(HistoryBucket))
+		if history == nil {
+			return nil
+		}
+		b := history.Bucket([]byte(resourceID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var entry StateVersion
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("decode version %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			versions = append(versions, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history for %s: %w", resourceID, err)
+	}
+	return versions, nil
+}
+
+// StateAtVersion returns a single recorded version of a resource.
+func (sm *StateManager) StateAtVersion(resourceID string, version uint64) (*StateVersion, error) {
+	var entry *StateVersion
+	err := sm.view(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte(HistoryBucket))
+		if history == nil {
+			return nil
+		}
+		b := history.Bucket([]byte(resourceID))
+		if b == nil {
+			return nil
+		}
+		data := b.Get(versionKey(version))
+		if data == nil {
+			return nil
+		}
+		entry = &StateVersion{}
+		return json.Unmarshal(data, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %d of %s: %w", version, resourceID, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("resource %s has no recorded version %d", resourceID, version)
+	}
+	return entry, nil
+}
+
+// RestoreRecordedState makes an earlier recorded version the current recorded
+// state of a resource. It only relabels the record: plans still diff the
+// desired state against the live system, and the restored state is only the
+// baseline that tells drift from desired changes. The restore is appended to
+// the history, so it can be undone too.
+//
+// A resource that is neither recorded nor declared would be recorded again
+// only to be deleted as an orphan by the next apply, so it is refused.
+func (sm *StateManager) RestoreRecordedState(resourceID string, version uint64, declared bool) error {
+	if !declared {
+		current, err := sm.ReadState(resourceID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("%s is neither recorded nor declared in the manifest; the next apply would delete it", resourceID)
+		}
+	}
+	entry, err := sm.StateAtVersion(resourceID, version)
+	if err != nil {
+		return err
+	}
+	return sm.RecordState(resourceID, entry.State, fmt.Sprintf("restore record v%d", version), nil)
+}
+
+// versionKey encodes a version number so that keys sort numerically.
+func versionKey(version uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, version)
+	return key
+}
+
+// currentUser returns the operator running slothctl, looking through sudo.
+func currentUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
@@ -0,0 +1,69 @@
+package statemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+var (
+	// ErrNotFound is returned when importing a resource that does not exist on
+	// the host.
+	ErrNotFound = errors.New("resource does not exist on this host")
+	// ErrAlreadyManaged is returned when importing a resource that already has
+	// a recorded state.
+	ErrAlreadyManaged = errors.New("resource already has a recorded state")
+)
+
+// Import records the live state of a resource that was set up outside of
+// slothctl, as if it had been applied, without changing the host. The
+// recorded state is returned.
+func (sm *StateManager) Import(ctx context.Context, res Resource) (map[string]interface{}, error) {
+	resourceID := res.ID()
+	recorded, err := sm.ReadState(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if recorded != nil {
+		return nil, fmt.Errorf("%s: %w", resourceID, ErrAlreadyManaged)
+	}
+
+	timeout := resourceTimeout(res)
+	readCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	live, err := res.ReadCurrentState(readCtx, sm.dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current state for %s: %w", resourceID, timeoutError(readCtx, timeout, err))
+	}
+	if live == nil {
+		return nil, fmt.Errorf("%s: %w", resourceID, ErrNotFound)
+	}
+
+	state := protectState(live, sensitiveKeys(res))
+	if sm.dryRun {
+		log.Info("Dry run: state not recorded", "id", resourceID)
+		return state, nil
+	}
+	if err := sm.RecordState(resourceID, state, "import", nil); err != nil {
+		return nil, fmt.Errorf("failed to record state for %s: %w", resourceID, err)
+	}
+	if err := sm.writeMeta(res); err != nil {
+		return nil, fmt.Errorf("failed to record lifecycle of %s: %w", resourceID, err)
+	}
+	log.Info("Imported resource", "id", resourceID)
+	return state, nil
+}
+
+// DiscoverableIDs returns the ID of the instance every discoverable kind
+// would have on a host, in lexical order of the kinds.
+func DiscoverableIDs() []string {
+	var ids []string
+	for _, name := range KindNames() {
+		if kind := kinds[name]; kind.DiscoverName != "" {
+			ids = append(ids, name+":"+kind.DiscoverName)
+		}
+	}
+	return ids
+}
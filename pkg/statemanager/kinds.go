@@ -0,0 +1,271 @@
+package statemanager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// AttributeType is the type of a resource attribute in a kind schema.
+type AttributeType string
+
+const (
+	AttrString AttributeType = "string"
+	AttrInt    AttributeType = "int"
+	AttrBool   AttributeType = "bool"
+	AttrList   AttributeType = "list" // A list of strings
+	AttrMap    AttributeType = "map"  // A map of strings to strings
+)
+
+// Attribute describes a single attribute accepted by a resource kind.
+type Attribute struct {
+	Type        AttributeType
+	Required    bool
+	Default     interface{} // Used when the attribute is not set; must match Type
+	Sensitive   bool        // Secrets such as passwords; never shown in plans or logs
+	Description string
+}
+
+// Schema maps attribute names to their definitions.
+type Schema map[string]Attribute
+
+// ResourceConfig is a validated resource declaration handed to a kind's
+// constructor. Attributes hold only known attributes, converted to their
+// schema type, with defaults applied.
+type ResourceConfig struct {
+	Name       string
+	ID         string
+	Lifecycle  Lifecycle
+	Attributes map[string]interface{}
+}
+
+// KindConstructor builds a resource from a validated declaration.
+type KindConstructor func(cfg ResourceConfig) (Resource, error)
+
+// Kind is a resource kind that can be declared in manifests.
+type Kind struct {
+	// Name is the kind used in manifests and as the prefix of resource IDs, e.g. "vault".
+	Name   string
+	Schema Schema
+	New    KindConstructor
+	// DiscoverName is the name given to the instance of the kind found on a
+	// host by state import --discover, e.g. "main". Kinds without one, such
+	// as users or files, can only be imported by name.
+	DiscoverName string
+}
+
+// kinds holds all registered resource kinds, keyed by name.
+var kinds = make(map[string]Kind)
+
+// RegisterKind makes a resource kind available to manifests. Kinds register
+// themselves from an init function, like commands do with AddCommandToRegistry.
+// Registering the same name twice or an invalid schema is a programming error
+// and panics.
+func RegisterKind(kind Kind) {
+	if kind.Name == "" || kind.New == nil {
+		panic("statemanager: kind must have a name and a constructor")
+	}
+	if _, exists := kinds[kind.Name]; exists {
+		panic(fmt.Sprintf("statemanager: kind %q registered twice", kind.Name))
+	}
+	for name, attr := range kind.Schema {
+		if attr.Default == nil {
+			continue
+		}
+		if _, err := convertAttribute(attr.Type, attr.Default); err != nil {
+			panic(fmt.Sprintf("statemanager: kind %q: default of attribute %q: %v", kind.Name, name, err))
+		}
+	}
+	kinds[kind.Name] = kind
+}
+
+// LookupKind returns the registered kind with the given name.
+func LookupKind(name string) (Kind, bool) {
+	kind, ok := kinds[name]
+	return kind, ok
+}
+
+// KindNames returns the names of all registered kinds in lexical order.
+func KindNames() []string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build validates a declaration against the kind's schema and constructs the
+// resource. Values of sensitive attributes are registered as secrets.
+func (k Kind) Build(name, id string, lifecycle Lifecycle, attrs map[string]interface{}) (Resource, error) {
+	validated, err := k.Schema.Validate(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = name
+	}
+	lifecycle.SensitiveAttributes = k.Schema.SensitiveAttributes()
+	for _, key := range lifecycle.SensitiveAttributes {
+		if value, ok := validated[key].(string); ok {
+			RegisterSecret(value)
+		}
+	}
+	return k.New(ResourceConfig{Name: name, ID: id, Lifecycle: lifecycle, Attributes: validated})
+}
+
+// Validate checks attrs against the schema. It rejects unknown attributes,
+// missing required attributes and values of the wrong type, and returns the
+// attributes converted to their schema types with defaults applied.
+func (s Schema) Validate(attrs map[string]interface{}) (map[string]interface{}, error) {
+	var problems []string
+	for name := range attrs {
+		if _, ok := s[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown attribute %q", name))
+		}
+	}
+
+	validated := make(map[string]interface{})
+	for name, attr := range s {
+		raw, ok := attrs[name]
+		if !ok || raw == nil {
+			if attr.Required {
+				problems = append(problems, fmt.Sprintf("attribute %q is required", name))
+			} else if attr.Default != nil {
+				validated[name], _ = convertAttribute(attr.Type, attr.Default)
+			}
+			continue
+		}
+		value, err := convertAttribute(attr.Type, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("attribute %q: %v", name, err))
+			continue
+		}
+		validated[name] = value
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return validated, nil
+}
+
+// Defaults returns the default values of the schema's attributes. It is used to
+// rebuild resources whose declaration is no longer available, such as resources
+// removed from a manifest.
+func (s Schema) Defaults() map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for name, attr := range s {
+		if attr.Default != nil {
+			defaults[name], _ = convertAttribute(attr.Type, attr.Default)
+		}
+	}
+	return defaults
+}
+
+// SensitiveAttributes returns the names of the schema's sensitive attributes.
+func (s Schema) SensitiveAttributes() []string {
+	var names []string
+	for name, attr := range s {
+		if attr.Sensitive {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// convertAttribute converts a decoded YAML or JSON value to the given type.
+// Numbers are accepted for strings so that values such as uid: 1000 do not
+// need to be quoted.
+func convertAttribute(typ AttributeType, v interface{}) (interface{}, error) {
+	switch typ {
+	case AttrString:
+		switch val := v.(type) {
+		case string:
+			return val, nil
+		case int, int64, float64:
+			return fmt.Sprintf("%v", val), nil
+		}
+	case AttrInt:
+		switch val := v.(type) {
+		case int:
+			return val, nil
+		case int64:
+			return int(val), nil
+		case float64:
+			if val == math.Trunc(val) {
+				return int(val), nil
+			}
+		}
+	case AttrBool:
+		if val, ok := v.(bool); ok {
+			return val, nil
+		}
+	case AttrList:
+		switch val := v.(type) {
+		case []string:
+			return val, nil
+		case []interface{}:
+			list := make([]string, 0, len(val))
+			for i, item := range val {
+				s, err := convertAttribute(AttrString, item)
+				if err != nil {
+					return nil, fmt.Errorf("item %d: %w", i, err)
+				}
+				list = append(list, s.(string))
+			}
+			return list, nil
+		}
+	case AttrMap:
+		switch val := v.(type) {
+		case map[string]string:
+			return val, nil
+		case map[string]interface{}:
+			m := make(map[string]string, len(val))
+			for key, item := range val {
+				s, err := convertAttribute(AttrString, item)
+				if err != nil {
+					return nil, fmt.Errorf("key %q: %w", key, err)
+				}
+				m[key] = s.(string)
+			}
+			return m, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown attribute type %q", typ)
+	}
+	return nil, fmt.Errorf("must be a %s, got %T", typ, v)
+}
+
+// String returns a string attribute, or "" if it is not set.
+func (c ResourceConfig) String(name string) string {
+	s, _ := c.Attributes[name].(string)
+	return s
+}
+
+// Int returns an int attribute, or 0 if it is not set.
+func (c ResourceConfig) Int(name string) int {
+	i, _ := c.Attributes[name].(int)
+	return i
+}
+
+// Bool returns a bool attribute, or false if it is not set.
+func (c ResourceConfig) Bool(name string) bool {
+	b, _ := c.Attributes[name].(bool)
+	return b
+}
+
+// List returns a list attribute, or nil if it is not set.
+func (c ResourceConfig) List(name string) []string {
+	l, _ := c.Attributes[name].([]string)
+	return l
+}
+
+// Map returns a map attribute, or nil if it is not set.
+func (c ResourceConfig) Map(name string) map[string]string {
+	m, _ := c.Attributes[name].(map[string]string)
+	return m
+}
@@ -0,0 +1,64 @@
+package statemanager
+
+import "time"
+
+// DefaultResourceTimeout bounds how long planning or applying a single resource
+// may take when the resource does not set its own timeout.
+const DefaultResourceTimeout = 30 * time.Minute
+
+// Lifecycle holds the options that apply to every resource kind regardless of
+// its attributes. Resources embed it to pick up the optional interfaces below.
+type Lifecycle struct {
+	// Dependencies lists the IDs of resources that must be applied first.
+	Dependencies []string
+	// PreventDestroy makes any plan that would delete the resource fail.
+	PreventDestroy bool
+	// Timeout bounds how long reading or applying the resource may take.
+	// Zero means DefaultResourceTimeout.
+	Timeout time.Duration
+	// SensitiveAttributes lists the keys whose values are secret.
+	SensitiveAttributes []string
+}
+
+// Dependent is implemented by resources that must be applied after others.
+type Dependent interface {
+	DependsOn() []string
+}
+
+// DestroyGuard is implemented by resources that can refuse to be deleted.
+type DestroyGuard interface {
+	DestroyPrevented() bool
+}
+
+// TimeLimited is implemented by resources with their own timeout.
+type TimeLimited interface {
+	ResourceTimeout() time.Duration
+}
+
+// DependsOn returns the IDs of the resources this resource depends on.
+func (l Lifecycle) DependsOn() []string {
+	return l.Dependencies
+}
+
+// DestroyPrevented reports whether the resource must not be deleted.
+func (l Lifecycle) DestroyPrevented() bool {
+	return l.PreventDestroy
+}
+
+// SensitiveKeys returns the keys whose values are secret.
+func (l Lifecycle) SensitiveKeys() []string {
+	return l.SensitiveAttributes
+}
+
+// ResourceTimeout returns how long reading or applying the resource may take.
+func (l Lifecycle) ResourceTimeout() time.Duration {
+	return l.Timeout
+}
+
+// resourceTimeout returns the timeout of a resource, or the default if it has none.
+func resourceTimeout(res Resource) time.Duration {
+	if limited, ok := res.(TimeLimited); ok && limited.ResourceTimeout() > 0 {
+		return limited.ResourceTimeout()
+	}
+	return DefaultResourceTimeout
+}
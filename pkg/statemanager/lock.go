@@ -0,0 +1,260 @@
+package statemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// LockBucket holds the state lock record.
+	LockBucket = "slothctl_lock"
+	lockKey    = "state"
+
+	// DefaultLockTTL is how long a lock stays valid without a heartbeat. A
+	// process that crashes while holding the lock releases it after this long.
+	DefaultLockTTL = 15 * time.Minute
+	// lockRetryInterval is how often a waiting process retries to take the lock.
+	lockRetryInterval = time.Second
+)
+
+// lockRenewInterval is how often a held lock is renewed.
+var lockRenewInterval = DefaultLockTTL / 3
+
+// ErrLocked is returned when another process holds the state lock.
+var ErrLocked = errors.New("state is locked")
+
+// ErrLockLost is the cause of the cancellation of a locked context when the
+// lock could not be renewed or was taken over by another process.
+var ErrLockLost = errors.New("state lock lost")
+
+// LockInfo describes who holds the state lock.
+type LockInfo struct {
+	ID         string        `json:"id"`
+	Holder     string        `json:"holder"`
+	Host       string        `json:"host"`
+	PID        int           `json:"pid"`
+	Operation  string        `json:"operation"`
+	AcquiredAt time.Time     `json:"acquired_at"`
+	RenewedAt  time.Time     `json:"renewed_at"`
+	TTL        time.Duration `json:"ttl"`
+}
+
+// Expired reports whether the holder stopped renewing the lock.
+func (l *LockInfo) Expired(now time.Time) bool {
+	return now.After(l.RenewedAt.Add(l.TTL))
+}
+
+// LockedError is returned when the state lock is held by someone else.
+type LockedError struct {
+	Lock LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("state is locked by %s@%s (pid %d, %s) since %s; lock ID %s",
+		e.Lock.Holder, e.Lock.Host, e.Lock.PID, e.Lock.Operation, e.Lock.AcquiredAt.Local().Format(time.RFC3339), e.Lock.ID)
+}
+
+// Is makes errors.Is(err, ErrLocked) match a LockedError.
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Lock takes the state lock for an operation, waiting up to wait for another
+// holder to release it or until ctx is cancelled. Locks are reentrant within a
+// StateManager, so a command can hold the lock across Plan and Apply. While
+// held, the lock is renewed in the background so long applies do not expire.
+//
+// The returned context is cancelled with ErrLockLost as its cause if the lock
+// cannot be renewed or is taken over, so work done under it stops instead of
+// racing another holder. It is also cancelled by Unlock. Nested calls return
+// ctx unchanged, so pass the context of the outermost Lock down.
+func (sm *StateManager) Lock(ctx context.Context, operation string, wait time.Duration) (context.Context, error) {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	if sm.lock != nil {
+		sm.lockDepth++
+		return ctx, nil
+	}
+
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	candidate := LockInfo{
+		ID:         uuid.New().String(),
+		Holder:     currentUser(),
+		Host:       host,
+		PID:        os.Getpid(),
+		Operation:  operation,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		TTL:        DefaultLockTTL,
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err := sm.tryLock(&candidate)
+		if err == nil {
+			break
+		}
+		var locked *LockedError
+		if !errors.As(err, &locked) || time.Now().After(deadline) {
+			return nil, err
+		}
+		log.Info("Waiting for state lock...", "holder", locked.Lock.Holder, "host", locked.Lock.Host, "operation", locked.Lock.Operation)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for state lock: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	sm.lock = &candidate
+	sm.lockDepth = 1
+	sm.lockStop = make(chan struct{})
+	sm.lockCancel = cancel
+	go sm.renewLock(candidate.ID, lockRenewInterval, sm.lockStop, cancel)
+	log.Debug("State lock acquired", "id", candidate.ID, "operation", operation)
+	return lockCtx, nil
+}
+
+// tryLock writes the lock record unless a live lock is held by someone else.
+func (sm *StateManager) tryLock(candidate *LockInfo) error {
+	return sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(LockBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		if data := b.Get([]byte(lockKey)); data != nil {
+			var held LockInfo
+			if err := json.Unmarshal(data, &held); err != nil {
+				return fmt.Errorf("failed to decode state lock: %w", err)
+			}
+			if !held.Expired(time.Now()) {
+				return &LockedError{Lock: held}
+			}
+			log.Warn("Taking over expired state lock", "holder", held.Holder, "host", held.Host, "pid", held.PID, "acquired_at", held.AcquiredAt)
+		}
+		data, err := json.Marshal(candidate)
+		if err != nil {
+			return fmt.Errorf("marshal lock: %w", err)
+		}
+		return b.Put([]byte(lockKey), data)
+	})
+}
+
+// renewLock extends the lock every interval until stop is closed. If the lock
+// cannot be renewed or is no longer ours, it cancels the locked context.
+func (sm *StateManager) renewLock(id string, interval time.Duration, stop chan struct{}, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := sm.update(func(tx *bbolt.Tx) error {
+				b := tx.Bucket([]byte(LockBucket))
+				if b == nil {
+					return fmt.Errorf("lock bucket disappeared")
+				}
+				var held LockInfo
+				if err := json.Unmarshal(b.Get([]byte(lockKey)), &held); err != nil || held.ID != id {
+					return fmt.Errorf("lock %s is no longer held", id)
+				}
+				held.RenewedAt = time.Now().UTC()
+				data, err := json.Marshal(held)
+				if err != nil {
+					return err
+				}
+				return b.Put([]byte(lockKey), data)
+			})
+			if err != nil {
+				log.Error("Failed to renew state lock; stopping", "id", id, "error", err)
+				cancel(fmt.Errorf("%w: %v", ErrLockLost, err))
+				return
+			}
+		}
+	}
+}
+
+// Unlock releases a lock taken with Lock once every nested Lock call is released.
+func (sm *StateManager) Unlock() error {
+	sm.lockMu.Lock()
+	defer sm.lockMu.Unlock()
+
+	if sm.lock == nil {
+		return nil
+	}
+	sm.lockDepth--
+	if sm.lockDepth > 0 {
+		return nil
+	}
+
+	close(sm.lockStop)
+	sm.lockCancel(nil)
+	id := sm.lock.ID
+	sm.lock = nil
+	if err := sm.deleteLock(id); err != nil {
+		return fmt.Errorf("failed to release state lock: %w", err)
+	}
+	log.Debug("State lock released", "id", id)
+	return nil
+}
+
+// CurrentLock returns the lock record, or nil if the state is not locked.
+func (sm *StateManager) CurrentLock() (*LockInfo, error) {
+	var held *LockInfo
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(LockBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(lockKey))
+		if data == nil {
+			return nil
+		}
+		held = &LockInfo{}
+		return json.Unmarshal(data, held)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state lock: %w", err)
+	}
+	return held, nil
+}
+
+// ForceUnlock removes the lock with the given ID regardless of who holds it.
+// It is meant for operators cleaning up after a crashed run.
+func (sm *StateManager) ForceUnlock(id string) error {
+	return sm.deleteLock(id)
+}
+
+// deleteLock removes the lock record if it has the given ID.
+func (sm *StateManager) deleteLock(id string) error {
+	return sm.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(LockBucket))
+		if b == nil {
+			return fmt.Errorf("state is not locked")
+		}
+		data := b.Get([]byte(lockKey))
+		if data == nil {
+			return fmt.Errorf("state is not locked")
+		}
+		var held LockInfo
+		if err := json.Unmarshal(data, &held); err != nil {
+			return fmt.Errorf("failed to decode state lock: %w", err)
+		}
+		if held.ID != id {
+			return fmt.Errorf("lock ID %s does not match the current lock %s held by %s@%s", id, held.ID, held.Holder, held.Host)
+		}
+		return b.Delete([]byte(lockKey))
+	})
+}
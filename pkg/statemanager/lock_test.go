@@ -0,0 +1,82 @@
+package statemanager
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockStopsWaitingWhenContextIsCancelled(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "state.db")
+	holder := NewStateManager(dbPath, false)
+	if _, err := holder.Lock(context.Background(), "apply", 0); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer holder.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewStateManager(dbPath, false).Lock(ctx, "plan", time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock error = %v, want the context deadline", err)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("Lock waited %s after the context was done", waited)
+	}
+}
+
+func TestUnlockCancelsTheLockedContext(t *testing.T) {
+	sm := NewStateManager(filepath.Join(t.TempDir(), "state.db"), false)
+	ctx, err := sm.Lock(context.Background(), "apply", 0)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	nested, err := sm.Lock(ctx, "plan", 0)
+	if err != nil {
+		t.Fatalf("nested Lock: %v", err)
+	}
+	if nested != ctx {
+		t.Errorf("nested Lock returned a new context")
+	}
+	sm.Unlock()
+	if ctx.Err() != nil {
+		t.Fatalf("context cancelled while the lock is still held")
+	}
+	sm.Unlock()
+	if ctx.Err() == nil {
+		t.Errorf("context not cancelled after the lock was released")
+	}
+}
+
+func TestLostLockCancelsTheLockedContext(t *testing.T) {
+	defer func(interval time.Duration) { lockRenewInterval = interval }(lockRenewInterval)
+	lockRenewInterval = 10 * time.Millisecond
+
+	sm := NewStateManager(filepath.Join(t.TempDir(), "state.db"), false)
+	ctx, err := sm.Lock(context.Background(), "apply", 0)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer sm.Unlock()
+
+	// An operator force-unlocks the state while the apply is still running.
+	held, err := sm.CurrentLock()
+	if err != nil || held == nil {
+		t.Fatalf("CurrentLock = %v, %v", held, err)
+	}
+	if err := sm.ForceUnlock(held.ID); err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled after the lock was lost")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrLockLost) {
+		t.Errorf("cause = %v, want ErrLockLost", cause)
+	}
+}
@@ -0,0 +1,151 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+	_ "github.com/chalkan3/slothctl/pkg/statemanager/resources" // Registers the built-in resource kinds
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the declarative description of the resources slothctl should manage.
+// It can be written in YAML or JSON, since JSON is a subset of YAML.
+type Manifest struct {
+	Resources []ResourceSpec `yaml:"resources" json:"resources"`
+}
+
+// ResourceSpec describes a single typed resource in a manifest.
+type ResourceSpec struct {
+	Kind           string                 `yaml:"kind" json:"kind"` // A registered resource kind, e.g. vault
+	Name           string                 `yaml:"name" json:"name"`
+	ID             string                 `yaml:"id,omitempty" json:"id,omitempty"`                           // Optional, defaults to the name
+	DependsOn      []string               `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`           // IDs of resources to apply first, e.g. salt_master:main
+	PreventDestroy bool                   `yaml:"prevent_destroy,omitempty" json:"prevent_destroy,omitempty"` // Fail any plan that would delete the resource
+	Timeout        string                 `yaml:"timeout,omitempty" json:"timeout,omitempty"`                 // Bound on reading or applying the resource, e.g. 10m
+	Attributes     map[string]interface{} `yaml:"attributes,omitempty" json:"attributes,omitempty"`           // Kind-specific attributes
+}
+
+// Load reads and parses a manifest file.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a YAML or JSON manifest document.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if len(m.Resources) == 0 {
+		return nil, fmt.Errorf("manifest does not declare any resources")
+	}
+	return &m, nil
+}
+
+// BuildResources converts the manifest entries into state manager resources.
+func (m *Manifest) BuildResources() ([]statemanager.Resource, error) {
+	var built []statemanager.Resource
+	seen := make(map[string]bool)
+
+	for i, spec := range m.Resources {
+		if spec.Kind == "" || spec.Name == "" {
+			return nil, fmt.Errorf("resource #%d: kind and name are required", i+1)
+		}
+		res, err := buildResource(spec)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s %q: %w", spec.Kind, spec.Name, err)
+		}
+		if seen[res.ID()] {
+			return nil, fmt.Errorf("duplicate resource %s", res.ID())
+		}
+		seen[res.ID()] = true
+		built = append(built, res)
+	}
+	return built, nil
+}
+
+// Declares reports whether the manifest declares the resource with the given ID.
+func (m *Manifest) Declares(resourceID string) (bool, error) {
+	resources, err := m.BuildResources()
+	if err != nil {
+		return false, err
+	}
+	for _, res := range resources {
+		if res.ID() == resourceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// buildResource validates a manifest entry against the schema of its kind and
+// creates the typed resource.
+func buildResource(spec ResourceSpec) (statemanager.Resource, error) {
+	kind, ok := statemanager.LookupKind(spec.Kind)
+	if !ok {
+		return nil, fmt.Errorf("unknown resource kind %q (supported: %s)", spec.Kind, strings.Join(statemanager.KindNames(), ", "))
+	}
+	lifecycle := statemanager.Lifecycle{Dependencies: spec.DependsOn, PreventDestroy: spec.PreventDestroy}
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q: must be a positive duration such as 10m", spec.Timeout)
+		}
+		lifecycle.Timeout = timeout
+	}
+	return kind.Build(spec.Name, spec.ID, lifecycle, spec.Attributes)
+}
+
+// ResourceForID rebuilds a resource from a recorded resource ID such as
+// "vault:main", so that resources removed from a manifest can be deleted.
+// Their attributes are no longer known, so the schema defaults are used.
+// It is meant to be passed to StateManager.SetResourceResolver.
+func ResourceForID(resourceID string) (statemanager.Resource, error) {
+	kindName, name, ok := strings.Cut(resourceID, ":")
+	if !ok || kindName == "" || name == "" {
+		return nil, fmt.Errorf("resource ID %q is not of the form kind:name", resourceID)
+	}
+	kind, ok := statemanager.LookupKind(kindName)
+	if !ok {
+		return nil, fmt.Errorf("unknown resource kind %q", kindName)
+	}
+	lifecycle := statemanager.Lifecycle{SensitiveAttributes: kind.Schema.SensitiveAttributes()}
+	res, err := kind.New(statemanager.ResourceConfig{Name: name, ID: name, Lifecycle: lifecycle, Attributes: kind.Schema.Defaults()})
+	if err != nil {
+		return nil, err
+	}
+	if res.ID() != resourceID {
+		return nil, fmt.Errorf("resource ID %q does not match rebuilt resource %q", resourceID, res.ID())
+	}
+	return res, nil
+}
+
+// JSON returns the manifest encoded as JSON, suitable for embedding in a saved
+// plan. A plan file is meant to be reviewed and committed, so manifests with
+// literal values for sensitive attributes are refused.
+func (m *Manifest) JSON() ([]byte, error) {
+	for _, spec := range m.Resources {
+		kind, ok := statemanager.LookupKind(spec.Kind)
+		if !ok {
+			continue
+		}
+		for _, key := range kind.Schema.SensitiveAttributes() {
+			if _, set := spec.Attributes[key]; set {
+				return nil, fmt.Errorf("resource %s %q: sensitive attribute %q cannot be saved in a plan file; read it from the environment instead, e.g. with %s_env", spec.Kind, spec.Name, key, key)
+			}
+		}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,74 @@
+package statemanager
+
+import "github.com/chalkan3/slothctl/internal/log"
+
+// Subscriber is implemented by resources that must be restarted when other
+// resources change, such as a service whose configuration file is managed by
+// a file resource. Subscribed resources must also be dependencies, so that
+// they are planned and applied first.
+type Subscriber interface {
+	RestartOn() []string
+}
+
+// Notifier is implemented by resources for which only some changes concern
+// their subscribers, e.g. a file whose mode changed but whose content did not.
+// Every other resource notifies its subscribers of any change.
+type Notifier interface {
+	Notifies(change Change) bool
+}
+
+// planRestart adds a restart to the changes of a subscriber when a resource it
+// subscribes to has a planned change that notifies it. planned holds the
+// changes of the resources planned so far and resources maps IDs to resources.
+// A subscriber that is created or started in the same plan starts with the
+// new configuration anyway, so it is not restarted.
+func planRestart(res Resource, changes, planned []Change, resources map[string]Resource) []Change {
+	subscriber, ok := res.(Subscriber)
+	if !ok {
+		return changes
+	}
+	for _, change := range changes {
+		if change.Type == ChangeTypeCreate {
+			return changes
+		}
+		if active, _ := change.NewValues["active"].(bool); active {
+			return changes
+		}
+	}
+
+	subscribed := make(map[string]bool)
+	for _, id := range subscriber.RestartOn() {
+		subscribed[id] = true
+	}
+	var triggers []interface{}
+	seen := make(map[string]bool)
+	for _, change := range planned {
+		if !subscribed[change.ResourceID] || seen[change.ResourceID] || change.Type == ChangeTypeNoOp {
+			continue
+		}
+		if notifier, ok := resources[change.ResourceID].(Notifier); ok && !notifier.Notifies(change) {
+			continue
+		}
+		seen[change.ResourceID] = true
+		triggers = append(triggers, change.ResourceID)
+	}
+	if len(triggers) == 0 {
+		return changes
+	}
+
+	log.Info("Planning restart of resource", "id", res.ID(), "triggered_by", triggers)
+	restart := Change{
+		Type:       ChangeTypeRestart,
+		ResourceID: res.ID(),
+		Origin:     OriginDesired,
+		Details:    map[string]interface{}{"triggered_by": triggers},
+	}
+	// The restart replaces a no-op, so the resource shows up as changed.
+	var kept []Change
+	for _, change := range changes {
+		if change.Type != ChangeTypeNoOp {
+			kept = append(kept, change)
+		}
+	}
+	return append(kept, restart)
+}
@@ -0,0 +1,251 @@
+package statemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"go.etcd.io/bbolt"
+)
+
+// MetaBucket holds lifecycle options of applied resources. They are kept apart
+// from the recorded state so they survive the resource being removed from the
+// manifest, which is exactly when prevent_destroy matters.
+const MetaBucket = "slothctl_state_meta"
+
+// ErrDestroyNotAllowed is returned when a plan deletes resources but destroying
+// was not explicitly allowed.
+var ErrDestroyNotAllowed = errors.New("plan deletes resources but destroy is not allowed")
+
+// ResourceResolver rebuilds a resource from its ID so that resources removed
+// from the manifest can still be deleted.
+type ResourceResolver func(resourceID string) (Resource, error)
+
+// resourceMeta is the persisted lifecycle of an applied resource.
+type resourceMeta struct {
+	PreventDestroy bool      `json:"prevent_destroy"`
+	Dependencies   []string  `json:"dependencies,omitempty"` // Orders deletes once the resource is an orphan
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SetResourceResolver sets how resources that only exist in the recorded state
+// are rebuilt. Without a resolver, Plan cannot propose deletes.
+func (sm *StateManager) SetResourceResolver(resolver ResourceResolver) {
+	sm.resolver = resolver
+}
+
+// SetAllowDestroy allows Apply to execute delete changes.
+func (sm *StateManager) SetAllowDestroy(allow bool) {
+	sm.allowDestroy = allow
+}
+
+// orphanResources resolves every recorded resource that is no longer desired.
+// Orphans that cannot be resolved are skipped with a warning.
+func (sm *StateManager) orphanResources(desired []Resource) ([]Resource, error) {
+	desiredIDs := make(map[string]bool, len(desired))
+	for _, res := range desired {
+		desiredIDs[res.ID()] = true
+	}
+	recordedIDs, err := sm.ListResourceIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []Resource
+	for _, resourceID := range recordedIDs {
+		if desiredIDs[resourceID] {
+			continue
+		}
+		if sm.resolver == nil {
+			log.Warn("Resource is no longer desired but cannot be resolved for deletion", "id", resourceID)
+			continue
+		}
+		res, err := sm.resolver(resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve orphaned resource %s: %w", resourceID, err)
+		}
+		orphans = append(orphans, res)
+	}
+	return orphans, nil
+}
+
+// orphanDeleteOrder returns the order in which orphans are deleted, as extra
+// dependencies for buildGraph. Orphans are rebuilt from their IDs alone, so
+// the dependencies recorded when they were last applied are reversed: a
+// resource is deleted after the orphans that depended on it, e.g. a salt
+// master after its minion.
+func (sm *StateManager) orphanDeleteOrder(orphans []Resource) (map[string][]string, error) {
+	isOrphan := make(map[string]bool, len(orphans))
+	for _, res := range orphans {
+		isOrphan[res.ID()] = true
+	}
+	order := make(map[string][]string)
+	for _, res := range orphans {
+		meta, err := sm.readMeta(res.ID())
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range meta.Dependencies {
+			if isOrphan[dep] {
+				order[dep] = append(order[dep], res.ID())
+			}
+		}
+	}
+	return order, nil
+}
+
+// planOrphans plans a delete for every recorded resource that is no longer
+// desired, in the order they are deleted.
+func (sm *StateManager) planOrphans(ctx context.Context, desired []Resource) ([]Change, error) {
+	orphans, err := sm.orphanResources(desired)
+	if err != nil {
+		return nil, err
+	}
+	deleteOrder, err := sm.orphanDeleteOrder(orphans)
+	if err != nil {
+		return nil, err
+	}
+	g, err := buildGraph(orphans, deleteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, resourceID := range g.order {
+		res := g.nodes[resourceID]
+		meta, err := sm.readMeta(resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if meta.PreventDestroy {
+			return nil, fmt.Errorf("resource %s was removed from the manifest but has prevent_destroy set; "+
+				"add it back, or set prevent_destroy to false and apply before removing it", resourceID)
+		}
+
+		recorded, err := sm.ReadState(resourceID)
+		if err != nil {
+			return nil, err
+		}
+		readCtx, cancel := context.WithTimeout(ctx, resourceTimeout(res))
+		live, err := res.ReadCurrentState(readCtx, sm.dryRun)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read current state for %s: %w", resourceID, err)
+		}
+
+		details := map[string]interface{}{"reason": "removed from the desired resources"}
+		if live == nil {
+			details["message"] = "already absent from the system; only the recorded state is removed"
+		}
+		log.Info("Planning deletion of orphaned resource", "id", resourceID)
+		changes = append(changes, redactChange(Change{
+			Type:       ChangeTypeDelete,
+			ResourceID: resourceID,
+			Origin:     OriginDesired,
+			OldValues:  recorded,
+			Details:    details,
+		}, sensitiveKeys(res)))
+	}
+	return changes, nil
+}
+
+// checkDestroy refuses deletes of protected resources, and any delete unless
+// destroying was allowed.
+func (sm *StateManager) checkDestroy(changes []Change, resources map[string]Resource) error {
+	deletes := 0
+	for _, change := range changes {
+		if change.Type != ChangeTypeDelete {
+			continue
+		}
+		deletes++
+		if guard, ok := resources[change.ResourceID].(DestroyGuard); ok && guard.DestroyPrevented() {
+			return fmt.Errorf("resource %s has prevent_destroy set and cannot be deleted", change.ResourceID)
+		}
+		meta, err := sm.readMeta(change.ResourceID)
+		if err != nil {
+			return err
+		}
+		if meta.PreventDestroy {
+			return fmt.Errorf("resource %s has prevent_destroy set and cannot be deleted", change.ResourceID)
+		}
+	}
+	if deletes > 0 && !sm.allowDestroy {
+		return fmt.Errorf("%w: %d resource(s) would be deleted; re-run with --allow-destroy", ErrDestroyNotAllowed, deletes)
+	}
+	return nil
+}
+
+// ForgetState removes the recorded state and lifecycle of a deleted resource
+// and records the deletion in its history.
+func (sm *StateManager) ForgetState(resourceID string, changes []Change) error {
+	return sm.update(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket([]byte(StateBucket)); b != nil {
+			if err := b.Delete([]byte(resourceID)); err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket([]byte(MetaBucket)); b != nil {
+			if err := b.Delete([]byte(resourceID)); err != nil {
+				return err
+			}
+		}
+		return appendHistory(tx, resourceID, nil, "delete", changes)
+	})
+}
+
+// recordLifecycle persists the lifecycle of a desired resource after it was
+// applied, so prevent_destroy still holds once it leaves the manifest.
+func (sm *StateManager) recordLifecycle(res Resource) error {
+	if sm.dryRun {
+		return nil
+	}
+	if err := sm.writeMeta(res); err != nil {
+		log.Error("Failed to record lifecycle of resource", "resource_id", res.ID(), "error", err)
+	}
+	return nil
+}
+
+// writeMeta persists the lifecycle options of a resource.
+func (sm *StateManager) writeMeta(res Resource) error {
+	meta := resourceMeta{UpdatedAt: time.Now().UTC()}
+	if guard, ok := res.(DestroyGuard); ok {
+		meta.PreventDestroy = guard.DestroyPrevented()
+	}
+	if dependent, ok := res.(Dependent); ok {
+		meta.Dependencies = dependent.DependsOn()
+	}
+	return sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(MetaBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("marshal meta: %w", err)
+		}
+		return b.Put([]byte(res.ID()), data)
+	})
+}
+
+// readMeta reads the persisted lifecycle options of a resource.
+func (sm *StateManager) readMeta(resourceID string) (resourceMeta, error) {
+	var meta resourceMeta
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(MetaBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(resourceID))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &meta)
+	})
+	if err != nil {
+		return meta, fmt.Errorf("failed to read lifecycle of %s: %w", resourceID, err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,113 @@
+package statemanager
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hostFixture records which fixture resources exist and the order in which
+// they were deleted.
+type hostFixture struct {
+	mu      sync.Mutex
+	present map[string]bool
+	deleted []string
+}
+
+// nodeResource is a resource that exists on the fixture host once applied.
+type nodeResource struct {
+	Lifecycle
+	name string
+	host *hostFixture
+}
+
+func (r *nodeResource) ID() string { return "node_fixture:" + r.name }
+
+func (r *nodeResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{"exists": true}
+}
+
+func (r *nodeResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	r.host.mu.Lock()
+	defer r.host.mu.Unlock()
+	if !r.host.present[r.ID()] {
+		return nil, nil
+	}
+	return map[string]interface{}{"exists": true}, nil
+}
+
+func (r *nodeResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]Change, error) {
+	if currentState != nil {
+		return []Change{{Type: ChangeTypeNoOp, ResourceID: r.ID()}}, nil
+	}
+	return []Change{{Type: ChangeTypeCreate, ResourceID: r.ID(), NewValues: desiredState}}, nil
+}
+
+func (r *nodeResource) Apply(ctx context.Context, dryRun bool, changes []Change) error {
+	for _, change := range changes {
+		if change.Type != ChangeTypeDelete {
+			r.host.mu.Lock()
+			r.host.present[r.ID()] = true
+			r.host.mu.Unlock()
+			continue
+		}
+		// Give a concurrent delete of a dependent the chance to run first.
+		time.Sleep(10 * time.Millisecond)
+		r.host.mu.Lock()
+		delete(r.host.present, r.ID())
+		r.host.deleted = append(r.host.deleted, r.ID())
+		r.host.mu.Unlock()
+	}
+	return nil
+}
+
+func TestOrphansAreDeletedAfterTheirDependents(t *testing.T) {
+	host := &hostFixture{present: make(map[string]bool)}
+	master := &nodeResource{name: "master", host: host}
+	minion := &nodeResource{name: "minion", host: host}
+	minion.Dependencies = []string{master.ID()}
+	desired := []Resource{minion, master}
+
+	sm := NewStateManager(filepath.Join(t.TempDir(), "state.db"), false)
+	sm.SetAllowDestroy(true)
+	// Like the manifest resolver, orphans are rebuilt from their IDs alone.
+	sm.SetResourceResolver(func(resourceID string) (Resource, error) {
+		kind, name, ok := strings.Cut(resourceID, ":")
+		if !ok || kind != "node_fixture" {
+			return nil, fmt.Errorf("unknown resource %s", resourceID)
+		}
+		return &nodeResource{name: name, host: host}, nil
+	})
+
+	ctx := context.Background()
+	changes, err := sm.Plan(ctx, desired)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if err := sm.Apply(ctx, changes, desired); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	changes, err = sm.Plan(ctx, nil)
+	if err != nil {
+		t.Fatalf("Plan without resources: %v", err)
+	}
+	var planned []string
+	for _, change := range changes {
+		planned = append(planned, change.ResourceID)
+	}
+	want := minion.ID() + "," + master.ID()
+	if got := strings.Join(planned, ","); got != want {
+		t.Errorf("planned deletes = %s, want %s", got, want)
+	}
+	if err := sm.Apply(ctx, changes, nil); err != nil {
+		t.Fatalf("Apply without resources: %v", err)
+	}
+	if got := strings.Join(host.deleted, ","); got != want {
+		t.Errorf("deleted = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package statemanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// PlanFormatVersion is the version of the saved plan file format.
+const PlanFormatVersion = 1
+
+// ErrStalePlan is returned when the state changed after a saved plan was made.
+var ErrStalePlan = errors.New("saved plan is stale")
+
+// SavedPlan is a reviewed plan that can be applied later exactly as it was made.
+type SavedPlan struct {
+	FormatVersion int             `json:"format_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Manifest      json.RawMessage `json:"manifest"`         // The manifest the plan was computed from
+	Fingerprint   string          `json:"fingerprint"`      // Hash of the recorded and live state the plan was computed against
+	Target        string          `json:"target,omitempty"` // Server the plan converges, as group:context:name; empty for the local host
+	Changes       []Change        `json:"changes"`
+}
+
+// WritePlanFile writes a saved plan as indented JSON so it can be reviewed in a
+// merge request. Registered secrets are redacted from the changes.
+func WritePlanFile(path string, plan *SavedPlan) error {
+	redacted := *plan
+	redacted.Changes = redactChanges(plan.Changes)
+	data, err := json.MarshalIndent(&redacted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write plan file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadPlanFile reads a saved plan written by WritePlanFile.
+func ReadPlanFile(path string) (*SavedPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file %s: %w", path, err)
+	}
+	var plan SavedPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file %s: %w", path, err)
+	}
+	if plan.FormatVersion != PlanFormatVersion {
+		return nil, fmt.Errorf("plan file %s has unsupported format version %d", path, plan.FormatVersion)
+	}
+	return &plan, nil
+}
+
+// Fingerprint hashes the recorded state in BoltDB and the live state of every
+// resource, including recorded resources that are no longer desired. Two
+// fingerprints are equal only if nothing changed in between.
+func (sm *StateManager) Fingerprint(ctx context.Context, resources []Resource) (string, error) {
+	orphans, err := sm.orphanResources(resources)
+	if err != nil {
+		return "", err
+	}
+	sorted := make([]Resource, 0, len(resources)+len(orphans))
+	sorted = append(append(sorted, resources...), orphans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID() < sorted[j].ID() })
+
+	hash := sha256.New()
+	for _, res := range sorted {
+		recorded, err := sm.ReadState(res.ID())
+		if err != nil {
+			return "", err
+		}
+		readCtx, cancel := context.WithTimeout(ctx, resourceTimeout(res))
+		live, err := res.ReadCurrentState(readCtx, true) // Probing only, no side effects
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("failed to read current state for %s: %w", res.ID(), err)
+		}
+		// json.Marshal sorts map keys, which keeps the encoding deterministic.
+		entry, err := json.Marshal([]interface{}{res.ID(), recorded, live})
+		if err != nil {
+			return "", fmt.Errorf("failed to encode state for %s: %w", res.ID(), err)
+		}
+		hash.Write(entry)
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyPlan checks that a saved plan was computed against the current state.
+func (sm *StateManager) VerifyPlan(ctx context.Context, plan *SavedPlan, resources []Resource) error {
+	fingerprint, err := sm.Fingerprint(ctx, resources)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint current state: %w", err)
+	}
+	if fingerprint != plan.Fingerprint {
+		return fmt.Errorf("%w: the recorded or live state changed since the plan was created at %s; run plan again",
+			ErrStalePlan, plan.CreatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
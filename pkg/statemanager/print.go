@@ -0,0 +1,290 @@
+package statemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ANSI color codes used when rendering plans to a terminal.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// PlanJSONFormatVersion is the version of the machine-readable plan format.
+// It is bumped whenever a field is removed or changes meaning; new fields may
+// be added without a bump.
+const PlanJSONFormatVersion = 1
+
+// PlanSummary counts the resources a plan adds, changes and destroys.
+type PlanSummary struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+}
+
+// HasChanges reports whether the plan changes anything.
+func (s PlanSummary) HasChanges() bool {
+	return s.Add+s.Change+s.Destroy > 0
+}
+
+// String returns the summary in the form "2 to add, 1 to change, 0 to destroy".
+func (s PlanSummary) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy", s.Add, s.Change, s.Destroy)
+}
+
+// PlanDocument is the stable, machine-readable form of a plan.
+type PlanDocument struct {
+	FormatVersion int         `json:"format_version"`
+	HasChanges    bool        `json:"has_changes"`
+	Summary       PlanSummary `json:"summary"`
+	Changes       []Change    `json:"changes"` // In the order they are applied; no-ops omitted
+}
+
+// resourceAction is the overall action a plan takes on a resource.
+type resourceAction int
+
+const (
+	actionNone resourceAction = iota
+	actionChange
+	actionAdd
+	actionDestroy
+)
+
+// resourcePlan groups the changes planned for one resource.
+type resourcePlan struct {
+	id      string
+	action  resourceAction
+	drift   bool
+	changes []Change
+}
+
+// groupChanges groups changes by resource, keeping the plan order and dropping no-ops.
+func groupChanges(changes []Change) []*resourcePlan {
+	var plans []*resourcePlan
+	byID := make(map[string]*resourcePlan)
+	for _, change := range changes {
+		if change.Type == ChangeTypeNoOp {
+			continue
+		}
+		rp, ok := byID[change.ResourceID]
+		if !ok {
+			rp = &resourcePlan{id: change.ResourceID}
+			byID[change.ResourceID] = rp
+			plans = append(plans, rp)
+		}
+		rp.changes = append(rp.changes, change)
+		if change.Origin == OriginDrift {
+			rp.drift = true
+		}
+
+		action := actionChange
+		switch change.Type {
+		case ChangeTypeCreate:
+			action = actionAdd
+		case ChangeTypeDelete:
+			action = actionDestroy
+		}
+		if action > rp.action {
+			rp.action = action
+		}
+	}
+	return plans
+}
+
+// Summarize counts the resources a plan adds, changes and destroys. A resource
+// with several changes is counted once, by its most significant change.
+func Summarize(changes []Change) PlanSummary {
+	var summary PlanSummary
+	for _, rp := range groupChanges(changes) {
+		switch rp.action {
+		case actionAdd:
+			summary.Add++
+		case actionDestroy:
+			summary.Destroy++
+		case actionChange:
+			summary.Change++
+		}
+	}
+	return summary
+}
+
+// NewPlanDocument builds the machine-readable form of a plan. Registered
+// secrets are redacted.
+func NewPlanDocument(changes []Change) PlanDocument {
+	summary := Summarize(changes)
+	doc := PlanDocument{
+		FormatVersion: PlanJSONFormatVersion,
+		HasChanges:    summary.HasChanges(),
+		Summary:       summary,
+		Changes:       []Change{},
+	}
+	for _, change := range redactChanges(changes) {
+		if change.Type != ChangeTypeNoOp {
+			doc.Changes = append(doc.Changes, change)
+		}
+	}
+	return doc
+}
+
+// WritePlanJSON writes the machine-readable form of a plan. Map keys are
+// sorted by encoding/json, so equal plans produce identical output.
+func WritePlanJSON(w io.Writer, changes []Change) error {
+	data, err := json.MarshalIndent(NewPlanDocument(changes), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// PrintChanges renders a plan for humans, coloring it when w is a terminal
+// and NO_COLOR is not set.
+func PrintChanges(w io.Writer, changes []Change) {
+	RenderChanges(w, changes, useColor(w))
+}
+
+// RenderChanges renders a plan as a tree of resources marked + (add),
+// ~ (change) or - (destroy), with their changed properties, followed by a
+// summary line. Registered secrets are redacted.
+func RenderChanges(w io.Writer, changes []Change, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	plans := groupChanges(redactChanges(changes))
+	if len(plans) == 0 {
+		fmt.Fprintln(w, "No changes. Infrastructure matches the manifest.")
+		return
+	}
+
+	for _, rp := range plans {
+		symbol, c, verb := "~", colorYellow, "will be changed"
+		switch rp.action {
+		case actionAdd:
+			symbol, c, verb = "+", colorGreen, "will be created"
+		case actionDestroy:
+			symbol, c, verb = "-", colorRed, "will be destroyed"
+		}
+		if rp.drift {
+			verb += " to correct drift"
+		}
+		fmt.Fprintf(w, "%s %s %s\n", paint(c, symbol), rp.id, verb)
+
+		for _, change := range rp.changes {
+			renderChange(w, change, paint)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Plan: %s.\n", Summarize(changes))
+}
+
+// renderChange writes the properties of a single change.
+func renderChange(w io.Writer, change Change, paint func(c, s string) string) {
+	fmt.Fprintf(w, "    # %s\n", change.Type)
+
+	shown := make(map[string]bool)
+	for _, key := range sortedKeys(change.NewValues, change.OldValues) {
+		shown[key] = true
+		oldValue, hasOld := change.OldValues[key]
+		newValue, hasNew := change.NewValues[key]
+		switch {
+		case hasOld && hasNew:
+			fmt.Fprintf(w, "    %s %s: %s -> %s\n", paint(colorYellow, "~"), key, formatValue(oldValue), formatValue(newValue))
+		case hasNew:
+			fmt.Fprintf(w, "    %s %s = %s\n", paint(colorGreen, "+"), key, formatValue(newValue))
+		default:
+			fmt.Fprintf(w, "    %s %s = %s\n", paint(colorRed, "-"), key, formatValue(oldValue))
+		}
+	}
+	for _, key := range sortedKeys(change.DiffProperties) {
+		if !shown[key] {
+			fmt.Fprintf(w, "    %s %s: %v\n", paint(colorYellow, "~"), key, change.DiffProperties[key])
+		}
+	}
+	for _, key := range sortedKeys(change.DriftProperties) {
+		fmt.Fprintf(w, "    %s %s changed outside slothctl: %v\n", paint(colorYellow, "!"), key, change.DriftProperties[key])
+	}
+	if triggers, ok := change.Details["triggered_by"].([]interface{}); ok {
+		for _, trigger := range triggers {
+			fmt.Fprintf(w, "    %s triggered by a change of %v\n", paint(colorYellow, "~"), trigger)
+		}
+	}
+	if failure, ok := change.Details["previous_failure"].(string); ok {
+		fmt.Fprintf(w, "    %s failed in %s\n", paint(colorRed, "!"), failure)
+	}
+	if message, ok := change.Details["message"].(string); ok && change.Type == ChangeTypeDelete {
+		fmt.Fprintf(w, "    (%s)\n", message)
+	}
+	if diff, ok := change.Details["diff"].(string); ok && diff != "" {
+		renderDiff(w, diff, paint)
+	}
+}
+
+// renderDiff writes a unified diff of file content, indented under its change.
+func renderDiff(w io.Writer, diff string, paint func(c, s string) string) {
+	for _, line := range splitLines(diff) {
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			line = paint(colorGreen, line)
+		case strings.HasPrefix(line, "-"):
+			line = paint(colorRed, line)
+		case strings.HasPrefix(line, "@@"):
+			line = paint(colorYellow, line)
+		}
+		fmt.Fprintf(w, "      %s\n", line)
+	}
+}
+
+// formatValue formats a property value, quoting strings so empty values stay visible.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// useColor reports whether w is a terminal that should receive colored output.
+func useColor(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// sortedKeys returns the union of the keys of the given maps in lexical order
+// for stable output.
+func sortedKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, values := range maps {
+		for key := range values {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,250 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"text/template"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+// FileResource represents a configuration file whose content is rendered from
+// a Go template. Its name is the absolute path of the file, so that a file
+// removed from the manifest can still be found and deleted.
+type FileResource struct {
+	statemanager.Lifecycle
+	Name    string
+	Path    string
+	Content []byte // Rendered content
+	Owner   string
+	Group   string
+	Mode    os.FileMode
+	Backup  bool // Keep the previous version next to the file when it is replaced or removed
+
+	mu      sync.Mutex
+	current []byte // Content read by ReadCurrentState, used to show a diff in the plan
+}
+
+// fileTemplateData is the data a file template is executed with.
+type fileTemplateData struct {
+	Name string
+	Path string
+	Vars map[string]string
+}
+
+// ID returns the unique identifier for the file resource.
+func (f *FileResource) ID() string {
+	return fmt.Sprintf("file:%s", f.Name)
+}
+
+// DesiredState returns the declared content checksum, ownership and mode of the file.
+func (f *FileResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"path":     f.Path,
+		"checksum": common.Checksum(f.Content),
+		"owner":    f.Owner,
+		"group":    f.Group,
+		"mode":     formatMode(f.Mode),
+	}
+}
+
+// ReadCurrentState reads the file's checksum, ownership and mode. It returns
+// nil if the file does not exist.
+func (f *FileResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	log.Info("Reading current state for file", "path", f.Path, "dry_run", dryRun)
+
+	executor := common.ExecutorFrom(ctx)
+	info, err := executor.Stat(ctx, f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		f.setCurrent(nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", f.Path, err)
+	}
+	if info.IsDir {
+		return nil, fmt.Errorf("%s is a directory", f.Path)
+	}
+	content, err := executor.ReadFile(ctx, f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Path, err)
+	}
+	f.setCurrent(content)
+
+	state := map[string]interface{}{
+		"path":     f.Path,
+		"checksum": common.Checksum(content),
+		"mode":     formatMode(info.Mode),
+		"owner":    info.Owner,
+		"group":    info.Group,
+	}
+	return state, nil
+}
+
+// Diff compares the current state with the desired state and returns changes.
+// Content changes carry a unified diff of the file in their details.
+func (f *FileResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+	if currentState == nil {
+		return []statemanager.Change{{
+			Type:       statemanager.ChangeTypeCreate,
+			ResourceID: f.ID(),
+			NewValues:  desiredState,
+			Details:    map[string]interface{}{"diff": statemanager.UnifiedDiff("/dev/null", f.Path, "", string(f.Content))},
+		}}, nil
+	}
+
+	change := configureChange(f.ID(), currentState, desiredState)
+	if change == nil {
+		return []statemanager.Change{{
+			Type:       statemanager.ChangeTypeNoOp,
+			ResourceID: f.ID(),
+			Details:    map[string]interface{}{"message": "No changes detected"},
+		}}, nil
+	}
+	if _, changed := change.DiffProperties["checksum"]; changed {
+		f.mu.Lock()
+		current := string(f.current)
+		f.mu.Unlock()
+		change.Details = map[string]interface{}{"diff": statemanager.UnifiedDiff(f.Path, f.Path, current, string(f.Content))}
+	}
+	return []statemanager.Change{*change}, nil
+}
+
+// Notifies reports whether a change concerns resources that restart on this
+// file: only changes of its content do, not of its ownership or mode.
+func (f *FileResource) Notifies(change statemanager.Change) bool {
+	if change.Type == statemanager.ChangeTypeCreate || change.Type == statemanager.ChangeTypeDelete {
+		return true
+	}
+	_, changed := change.DiffProperties["checksum"]
+	return changed
+}
+
+// Apply applies the changes to the system. The file is always rewritten as a
+// whole, which also corrects its ownership and mode.
+func (f *FileResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
+	for _, change := range changes {
+		log.Info("Applying change for file", "change_type", change.Type, "path", f.Path, "dry_run", dryRun)
+		switch change.Type {
+		case statemanager.ChangeTypeCreate, statemanager.ChangeTypeConfigure, statemanager.ChangeTypeUpdate:
+			if err := common.WriteFileAtomic(ctx, f.Name, dryRun, f.Path, f.Content, f.fileOptions()); err != nil {
+				return fmt.Errorf("failed to write file %s: %w", f.Path, err)
+			}
+		case statemanager.ChangeTypeDelete:
+			if err := common.RemoveFile(ctx, f.Name, dryRun, f.Path, f.Backup); err != nil {
+				return fmt.Errorf("failed to remove file %s: %w", f.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Undo reverts a change made by Apply. Replaced and removed files are restored
+// from their backup, so this requires backup to be enabled.
+func (f *FileResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for file", "change_type", change.Type, "path", f.Path, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return common.RemoveFile(ctx, f.Name, dryRun, f.Path, false)
+	case statemanager.ChangeTypeConfigure, statemanager.ChangeTypeUpdate, statemanager.ChangeTypeDelete:
+		if !f.Backup {
+			return statemanager.ErrUndoUnsupported
+		}
+		return common.RestoreBackup(ctx, f.Name, dryRun, f.Path)
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func (f *FileResource) setCurrent(content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = content
+}
+
+func (f *FileResource) fileOptions() common.FileOptions {
+	return common.FileOptions{Owner: f.Owner, Group: f.Group, Mode: f.Mode, Backup: f.Backup}
+}
+
+// formatMode formats permission bits the way they are declared, e.g. "0644".
+func formatMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", uint32(mode.Perm()))
+}
+
+// renderFileTemplate renders the content of a file resource from an inline
+// template or a template file.
+func renderFileTemplate(cfg statemanager.ResourceConfig, path string) ([]byte, error) {
+	text, source := cfg.String("content"), cfg.String("source")
+	switch {
+	case text != "" && source != "":
+		return nil, fmt.Errorf("content and source are mutually exclusive")
+	case source != "":
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		text = string(data)
+	}
+
+	name := source
+	if name == "" {
+		name = cfg.Name
+	}
+	tmpl, err := template.New(filepath.Base(name)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fileTemplateData{Name: cfg.Name, Path: path, Vars: cfg.Map("vars")}); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name: "file",
+		Schema: statemanager.Schema{
+			"content": {Type: statemanager.AttrString, Description: "Go template of the file content"},
+			"source":  {Type: statemanager.AttrString, Description: "Path of a Go template file with the content"},
+			"vars":    {Type: statemanager.AttrMap, Description: "Variables available to the template as .Vars"},
+			"owner":   {Type: statemanager.AttrString, Default: "root", Description: "Owning user"},
+			"group":   {Type: statemanager.AttrString, Default: "root", Description: "Owning group"},
+			"mode":    {Type: statemanager.AttrString, Default: "0644", Description: "Permission bits in octal"},
+			"backup":  {Type: statemanager.AttrBool, Default: true, Description: "Keep the previous version as <path>" + common.BackupSuffix},
+		},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			path := cfg.Name
+			if !filepath.IsAbs(path) {
+				return nil, fmt.Errorf("name %q must be the absolute path of the file", path)
+			}
+			mode, err := strconv.ParseUint(cfg.String("mode"), 8, 32)
+			if err != nil || mode > 0o777 {
+				return nil, fmt.Errorf("invalid mode %q: must be octal permission bits such as 0644", cfg.String("mode"))
+			}
+			content, err := renderFileTemplate(cfg, path)
+			if err != nil {
+				return nil, err
+			}
+			return &FileResource{
+				Lifecycle: cfg.Lifecycle,
+				Name:      cfg.Name,
+				Path:      filepath.Clean(path),
+				Content:   content,
+				Owner:     cfg.String("owner"),
+				Group:     cfg.String("group"),
+				Mode:      os.FileMode(mode),
+				Backup:    cfg.Bool("backup"),
+			}, nil
+		},
+	})
+}
@@ -1,18 +1,21 @@
 package resources
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/incus"
+	"github.com/chalkan3/slothctl/pkg/config"
 	"github.com/chalkan3/slothctl/pkg/statemanager"
 )
 
 // IncusResource represents an Incus host.
 type IncusResource struct {
+	statemanager.Lifecycle
 	ResourceID string
 	Name       string
-	// Add more Incus-specific attributes here (e.g., version, storage pools, networks)
+	Preseed    *incus.Preseed // Storage pools, networks and profiles, from the slothctl configuration
 }
 
 // ID returns the unique identifier for the Incus resource.
@@ -20,39 +23,68 @@ func (i *IncusResource) ID() string {
 	return fmt.Sprintf("incus:%s", i.Name)
 }
 
-// ReadCurrentState reads the current state of the Incus host from the system.
-func (i *IncusResource) ReadCurrentState(dryRun bool) (map[string]interface{}, error) {
+// DesiredState returns the declared configuration of the Incus host.
+func (i *IncusResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        i.Name,
+		"installed":   true,
+		"enabled":     true,
+		"active":      true,
+		"initialized": true,
+		"preseed":     incus.Summary(nil),
+	}
+}
+
+// ReadCurrentState reads the current state of the Incus host from the system:
+// package version, service state, whether Incus has been initialized and how
+// its configuration differs from the preseed.
+func (i *IncusResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
 	log.Info("Reading current state for Incus", "name", i.Name, "dry_run", dryRun)
-	// Simplified: In a real scenario, you'd check if Incus is installed and initialized.
-	return nil, nil // Assume it doesn't exist for now to always plan creation
+
+	state, err := probeService(ctx, incus.PackageName, incus.ServiceName, "")
+	if err != nil || state == nil {
+		return nil, err
+	}
+	state["name"] = i.Name
+
+	initialized := false
+	preseed := "unknown"
+	if active, _ := statemanager.StateBool(state, "active"); active {
+		initialized, err = incus.IsInitialized(ctx)
+		if err != nil {
+			return nil, err
+		}
+		current, err := incus.CurrentPreseed(ctx)
+		if err != nil {
+			return nil, err
+		}
+		_, changes, err := incus.DiffPreseed(i.Preseed, current)
+		if err != nil {
+			return nil, err
+		}
+		preseed = incus.Summary(changes)
+	}
+	state["initialized"] = initialized
+	state["preseed"] = preseed
+
+	return state, nil
 }
 
 // Diff compares the current state with the desired state and returns changes.
-func (i *IncusResource) Diff(currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+func (i *IncusResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
 	var changes []statemanager.Change
 
 	if currentState == nil {
 		changes = append(changes, statemanager.Change{
 			Type:       statemanager.ChangeTypeCreate,
 			ResourceID: i.ID(),
-			NewValues:  map[string]interface{}{"name": i.Name, "id": i.ResourceID, "kind": "incus", "version": "12.12"},
+			NewValues:  map[string]interface{}{"name": i.Name, "id": i.ResourceID, "kind": "incus"},
 		})
 		return changes, nil
 	}
 
-	// For simplicity, assume only 'name' can be updated for now.
-	// In a real scenario, you'd compare all relevant attributes.
-	currentName := currentState["name"].(string)
-	desiredName := desiredState["name"].(string)
-
-	if currentName != desiredName {
-		changes = append(changes, statemanager.Change{
-			Type:           statemanager.ChangeTypeUpdate,
-			ResourceID:     i.ID(),
-			OldValues:      map[string]interface{}{"name": currentName},
-			NewValues:      map[string]interface{}{"name": desiredName},
-			DiffProperties: map[string]interface{}{"name": fmt.Sprintf("%s -> %s", currentName, desiredName)},
-		})
+	if change := configureChange(i.ID(), currentState, desiredState); change != nil {
+		changes = append(changes, *change)
 	}
 
 	if len(changes) == 0 {
@@ -67,21 +99,50 @@ func (i *IncusResource) Diff(currentState, desiredState map[string]interface{})
 }
 
 // Apply applies the changes to the system.
-func (i *IncusResource) Apply(dryRun bool, changes []statemanager.Change) error {
+func (i *IncusResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
 	for _, change := range changes {
 		log.Info("Applying change for Incus", "change_type", change.Type, "name", i.Name, "dry_run", dryRun)
 		switch change.Type {
 		case statemanager.ChangeTypeCreate:
-			// Call the actual Incus installation/configuration logic here
-			// For now, just log that it would be installed
-			if err := incus.InstallAndConfigureIncus(i.Name, dryRun); err != nil {
+			if err := incus.InstallAndConfigureIncus(ctx, i.Name, dryRun, i.Preseed); err != nil {
 				return fmt.Errorf("failed to install and configure Incus: %w", err)
 			}
+		case statemanager.ChangeTypeConfigure:
+			if err := incus.ConfigureIncus(ctx, i.Name, dryRun, i.Preseed); err != nil {
+				return fmt.Errorf("failed to configure Incus: %w", err)
+			}
 		case statemanager.ChangeTypeUpdate:
 			log.Info("Incus update not yet implemented.", "dry_run", dryRun)
 		case statemanager.ChangeTypeDelete:
-			log.Info("Incus deletion not yet implemented.", "dry_run", dryRun)
+			if err := incus.RemoveIncus(ctx, i.Name, dryRun); err != nil {
+				return fmt.Errorf("failed to remove Incus: %w", err)
+			}
 		}
 	}
 	return nil
 }
+
+// Undo reverts a change made by Apply. Configuration changes cannot be
+// reverted because the previous configuration is not kept.
+func (i *IncusResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for Incus", "change_type", change.Type, "name", i.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return incus.RemoveIncus(ctx, i.Name, dryRun)
+	case statemanager.ChangeTypeDelete:
+		return incus.InstallAndConfigureIncus(ctx, i.Name, dryRun, i.Preseed)
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name:   "incus",
+		Schema: statemanager.Schema{},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &IncusResource{Lifecycle: cfg.Lifecycle, ResourceID: cfg.ID, Name: cfg.Name, Preseed: config.AppConfig.IncusPreseed()}, nil
+		},
+		DiscoverName: "main",
+	})
+}
@@ -0,0 +1,167 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+// PackageResource represents a system package, optionally pinned to a version.
+// It is installed with the package manager of the running distribution, and
+// its name is translated with common.ResolvePackageName.
+type PackageResource struct {
+	statemanager.Lifecycle
+	Name    string
+	Version string // Pinned version; empty accepts any installed version
+}
+
+// ID returns the unique identifier for the package resource.
+func (p *PackageResource) ID() string {
+	return fmt.Sprintf("package:%s", p.Name)
+}
+
+// DesiredState returns the declared package state.
+func (p *PackageResource) DesiredState() map[string]interface{} {
+	state := map[string]interface{}{"installed": true}
+	if p.Version != "" {
+		state["version"] = p.Version
+	}
+	return state
+}
+
+// ReadCurrentState reads the installed version of the package. It returns nil
+// if the package is not installed.
+func (p *PackageResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	log.Info("Reading current state for package", "name", p.Name, "dry_run", dryRun)
+
+	version, installed, err := common.InstalledPackageVersion(ctx, p.Name)
+	if err != nil || !installed {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"installed": true,
+		"version":   version,
+	}, nil
+}
+
+// Diff compares the current state with the desired state and returns changes.
+// An installed package satisfies a pin if its version matches it, ignoring
+// the packaging revision. A pin that would have to be installed by a package
+// manager that cannot install pinned versions fails the plan.
+func (p *PackageResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+	if currentState == nil {
+		if err := p.checkPin(ctx); err != nil {
+			return nil, err
+		}
+		return []statemanager.Change{{
+			Type:       statemanager.ChangeTypeCreate,
+			ResourceID: p.ID(),
+			NewValues:  desiredState,
+		}}, nil
+	}
+
+	installed, err := statemanager.StateString(currentState, "version")
+	if err != nil {
+		return nil, err
+	}
+	if !common.VersionMatches(installed, p.Version) {
+		if err := p.checkPin(ctx); err != nil {
+			return nil, err
+		}
+		return []statemanager.Change{{
+			Type:           statemanager.ChangeTypeUpdate,
+			ResourceID:     p.ID(),
+			OldValues:      map[string]interface{}{"version": installed},
+			NewValues:      map[string]interface{}{"version": p.Version},
+			DiffProperties: map[string]interface{}{"version": fmt.Sprintf("%s -> %s", installed, p.Version)},
+		}}, nil
+	}
+	return []statemanager.Change{{
+		Type:       statemanager.ChangeTypeNoOp,
+		ResourceID: p.ID(),
+		Details:    map[string]interface{}{"message": "Already installed", "version": installed},
+	}}, nil
+}
+
+// Apply applies the changes to the system.
+func (p *PackageResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
+	for _, change := range changes {
+		log.Info("Applying change for package", "change_type", change.Type, "name", p.Name, "version", p.Version, "dry_run", dryRun)
+		switch change.Type {
+		case statemanager.ChangeTypeCreate, statemanager.ChangeTypeUpdate:
+			if err := p.install(ctx, dryRun, p.Version); err != nil {
+				return err
+			}
+		case statemanager.ChangeTypeDelete:
+			if err := common.RemovePackages(ctx, p.Name, dryRun, []string{p.Name}); err != nil {
+				return fmt.Errorf("failed to remove package %s: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Undo reverts a change made by Apply. A version change is undone by
+// installing the previous version, which the repositories may no longer carry.
+func (p *PackageResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for package", "change_type", change.Type, "name", p.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return common.RemovePackages(ctx, p.Name, dryRun, []string{p.Name})
+	case statemanager.ChangeTypeUpdate:
+		previous, err := statemanager.StateString(change.OldValues, "version")
+		if err != nil {
+			return err
+		}
+		return p.install(ctx, dryRun, previous)
+	case statemanager.ChangeTypeDelete:
+		return p.install(ctx, dryRun, "")
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+// checkPin fails if the package is pinned to a version that the host's
+// package manager cannot install.
+func (p *PackageResource) checkPin(ctx context.Context) error {
+	if p.Version == "" {
+		return nil
+	}
+	pm, err := common.DetectPackageManager(ctx)
+	if err != nil {
+		return err
+	}
+	if !pm.PinsVersions() {
+		return fmt.Errorf("package %s is pinned to %s, but %s on %s: %w; remove the version",
+			p.Name, p.Version, pm.Name(), common.ExecutorFrom(ctx), common.ErrVersionPinUnsupported)
+	}
+	return nil
+}
+
+// install installs the package at the given version, or the latest if empty.
+func (p *PackageResource) install(ctx context.Context, dryRun bool, version string) error {
+	pm, err := common.DetectPackageManager(ctx)
+	if err != nil {
+		return err
+	}
+	pkg := common.Package{Name: common.ResolvePackageName(pm.Name(), p.Name), Version: version}
+	if err := pm.Install(ctx, p.Name, dryRun, []common.Package{pkg}); err != nil {
+		return fmt.Errorf("failed to install package %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name: "package",
+		Schema: statemanager.Schema{
+			"version": {Type: statemanager.AttrString, Description: "Version to pin, e.g. 1.15.2, matched with or without the packaging revision; not supported with pacman"},
+		},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &PackageResource{Lifecycle: cfg.Lifecycle, Name: cfg.Name, Version: cfg.String("version")}, nil
+		},
+	})
+}
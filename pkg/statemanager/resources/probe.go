@@ -0,0 +1,78 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+// probeService reads the live state shared by package-backed services: the
+// installed package version, the systemd unit state and, if configPath is set,
+// the checksum of its configuration file. It returns nil if the package is not
+// installed.
+func probeService(ctx context.Context, pkg, unit, configPath string) (map[string]interface{}, error) {
+	version, installed, err := common.InstalledPackageVersion(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, nil
+	}
+
+	enabled, active, err := common.ServiceStatus(ctx, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	state := map[string]interface{}{
+		"installed": true,
+		"version":   version,
+		"enabled":   enabled,
+		"active":    active,
+	}
+
+	if configPath != "" {
+		checksum, exists, err := common.FileChecksum(ctx, configPath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			checksum = ""
+		}
+		state["config_checksum"] = checksum
+	}
+
+	return state, nil
+}
+
+// configureChange returns a configure change for every desired attribute whose
+// live value differs, or nil if the live state already matches.
+func configureChange(resourceID string, currentState, desiredState map[string]interface{}) *statemanager.Change {
+	oldValues := make(map[string]interface{})
+	newValues := make(map[string]interface{})
+	diff := make(map[string]interface{})
+
+	for key, want := range desiredState {
+		got := currentState[key]
+		if reflect.DeepEqual(got, want) {
+			continue
+		}
+		oldValues[key] = got
+		newValues[key] = want
+		diff[key] = fmt.Sprintf("%v -> %v", got, want)
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+	return &statemanager.Change{
+		Type:           statemanager.ChangeTypeConfigure,
+		ResourceID:     resourceID,
+		OldValues:      oldValues,
+		NewValues:      newValues,
+		DiffProperties: diff,
+	}
+}
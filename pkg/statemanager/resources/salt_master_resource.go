@@ -1,18 +1,22 @@
 package resources
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/salt"
+	"github.com/chalkan3/slothctl/pkg/config"
 	"github.com/chalkan3/slothctl/pkg/statemanager"
 )
 
 // SaltMasterResource represents a Salt Master instance.
 type SaltMasterResource struct {
+	statemanager.Lifecycle
 	ResourceID string
 	Name       string
-	// Add more Salt Master-specific attributes here (e.g., config, version)
+	Config     salt.Config // From the slothctl configuration
 }
 
 // ID returns the unique identifier for the Salt Master resource.
@@ -20,39 +24,45 @@ func (s *SaltMasterResource) ID() string {
 	return fmt.Sprintf("salt_master:%s", s.Name)
 }
 
-// ReadCurrentState reads the current state of the Salt Master from the system.
-func (s *SaltMasterResource) ReadCurrentState(dryRun bool) (map[string]interface{}, error) {
+// DesiredState returns the declared configuration of the Salt Master.
+func (s *SaltMasterResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"name":            s.Name,
+		"installed":       true,
+		"enabled":         true,
+		"active":          true,
+		"config_checksum": common.Checksum([]byte(salt.MasterConfigContent(s.Config))),
+	}
+}
+
+// ReadCurrentState reads the current state of the Salt Master from the system:
+// package version, service state and configuration checksum.
+func (s *SaltMasterResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
 	log.Info("Reading current state for Salt Master", "name", s.Name, "dry_run", dryRun)
-	// Simplified: In a real scenario, you'd check if Salt Master is installed and running.
-	return nil, nil // Assume it doesn't exist for now to always plan creation
+
+	state, err := probeService(ctx, salt.MasterPackageName, salt.MasterServiceName, salt.MasterConfigPath)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	state["name"] = s.Name
+	return state, nil
 }
 
 // Diff compares the current state with the desired state and returns changes.
-func (s *SaltMasterResource) Diff(currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+func (s *SaltMasterResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
 	var changes []statemanager.Change
 
 	if currentState == nil {
 		changes = append(changes, statemanager.Change{
 			Type:       statemanager.ChangeTypeCreate,
 			ResourceID: s.ID(),
-			NewValues:  map[string]interface{}{"name": s.Name, "id": s.ResourceID, "kind": "salt_master", "version": "12.12"},
+			NewValues:  map[string]interface{}{"name": s.Name, "id": s.ResourceID, "kind": "salt_master"},
 		})
 		return changes, nil
 	}
 
-	// For simplicity, assume only 'name' can be updated for now.
-	// In a real scenario, you'd compare all relevant attributes.
-	currentName := currentState["name"].(string)
-	desiredName := desiredState["name"].(string)
-
-	if currentName != desiredName {
-		changes = append(changes, statemanager.Change{
-			Type:           statemanager.ChangeTypeUpdate,
-			ResourceID:     s.ID(),
-			OldValues:      map[string]interface{}{"name": currentName},
-			NewValues:      map[string]interface{}{"name": desiredName},
-			DiffProperties: map[string]interface{}{"name": fmt.Sprintf("%s -> %s", currentName, desiredName)},
-		})
+	if change := configureChange(s.ID(), currentState, desiredState); change != nil {
+		changes = append(changes, *change)
 	}
 
 	if len(changes) == 0 {
@@ -67,21 +77,50 @@ func (s *SaltMasterResource) Diff(currentState, desiredState map[string]interfac
 }
 
 // Apply applies the changes to the system.
-func (s *SaltMasterResource) Apply(dryRun bool, changes []statemanager.Change) error {
+func (s *SaltMasterResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
 	for _, change := range changes {
 		log.Info("Applying change for Salt Master", "change_type", change.Type, "name", s.Name, "dry_run", dryRun)
 		switch change.Type {
 		case statemanager.ChangeTypeCreate:
-			// Call the actual Salt Master installation/configuration logic here
-			// For now, just log that it would be installed
-			if err := salt.InstallAndConfigureSalt(s.Name, dryRun, true, ""); err != nil {
+			if err := salt.InstallAndConfigureSalt(ctx, s.Name, dryRun, true, "", s.Config); err != nil {
 				return fmt.Errorf("failed to install and configure Salt Master: %w", err)
 			}
+		case statemanager.ChangeTypeConfigure:
+			if err := salt.ConfigureMaster(ctx, s.Name, dryRun, s.Config); err != nil {
+				return fmt.Errorf("failed to configure Salt Master: %w", err)
+			}
 		case statemanager.ChangeTypeUpdate:
 			log.Info("Salt Master update not yet implemented.", "dry_run", dryRun)
 		case statemanager.ChangeTypeDelete:
-			log.Info("Salt Master deletion not yet implemented.", "dry_run", dryRun)
+			if err := salt.RemoveMaster(ctx, s.Name, dryRun); err != nil {
+				return fmt.Errorf("failed to remove Salt Master: %w", err)
+			}
 		}
 	}
 	return nil
 }
+
+// Undo reverts a change made by Apply. Configuration changes cannot be
+// reverted because the previous configuration is not kept.
+func (s *SaltMasterResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for Salt Master", "change_type", change.Type, "name", s.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return salt.RemoveMaster(ctx, s.Name, dryRun)
+	case statemanager.ChangeTypeDelete:
+		return salt.InstallAndConfigureSalt(ctx, s.Name, dryRun, true, "", s.Config)
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name:   "salt_master",
+		Schema: statemanager.Schema{},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &SaltMasterResource{Lifecycle: cfg.Lifecycle, ResourceID: cfg.ID, Name: cfg.Name, Config: config.AppConfig.Salt}, nil
+		},
+		DiscoverName: "master",
+	})
+}
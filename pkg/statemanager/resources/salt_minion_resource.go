@@ -1,18 +1,22 @@
 package resources
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/salt"
+	"github.com/chalkan3/slothctl/pkg/config"
 	"github.com/chalkan3/slothctl/pkg/statemanager"
 )
 
 // SaltMinionResource represents a Salt Minion instance.
 type SaltMinionResource struct {
+	statemanager.Lifecycle
 	ResourceID string
 	Name       string
-	// Add more Salt Minion-specific attributes here (e.g., master address, minion ID)
+	Config     salt.Config // From the slothctl configuration
 }
 
 // ID returns the unique identifier for the Salt Minion resource.
@@ -20,39 +24,45 @@ func (s *SaltMinionResource) ID() string {
 	return fmt.Sprintf("salt_minion:%s", s.Name)
 }
 
-// ReadCurrentState reads the current state of the Salt Minion from the system.
-func (s *SaltMinionResource) ReadCurrentState(dryRun bool) (map[string]interface{}, error) {
+// DesiredState returns the declared configuration of the Salt Minion.
+func (s *SaltMinionResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"name":            s.Name,
+		"installed":       true,
+		"enabled":         true,
+		"active":          true,
+		"config_checksum": common.Checksum([]byte(salt.MinionConfigContent(s.Config))),
+	}
+}
+
+// ReadCurrentState reads the current state of the Salt Minion from the system:
+// package version, service state and configuration checksum.
+func (s *SaltMinionResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
 	log.Info("Reading current state for Salt Minion", "name", s.Name, "dry_run", dryRun)
-	// Simplified: In a real scenario, you'd check if Salt Minion is installed and running.
-	return nil, nil // Assume it doesn't exist for now to always plan creation
+
+	state, err := probeService(ctx, salt.MinionPackageName, salt.MinionServiceName, salt.MinionConfigPath)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	state["name"] = s.Name
+	return state, nil
 }
 
 // Diff compares the current state with the desired state and returns changes.
-func (s *SaltMinionResource) Diff(currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+func (s *SaltMinionResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
 	var changes []statemanager.Change
 
 	if currentState == nil {
 		changes = append(changes, statemanager.Change{
 			Type:       statemanager.ChangeTypeCreate,
 			ResourceID: s.ID(),
-			NewValues:  map[string]interface{}{"name": s.Name, "id": s.ResourceID, "kind": "salt_minion", "version": "12.12"},
+			NewValues:  map[string]interface{}{"name": s.Name, "id": s.ResourceID, "kind": "salt_minion"},
 		})
 		return changes, nil
 	}
 
-	// For simplicity, assume only 'name' can be updated for now.
-	// In a real scenario, you'd compare all relevant attributes.
-	currentName := currentState["name"].(string)
-	desiredName := desiredState["name"].(string)
-
-	if currentName != desiredName {
-		changes = append(changes, statemanager.Change{
-			Type:           statemanager.ChangeTypeUpdate,
-			ResourceID:     s.ID(),
-			OldValues:      map[string]interface{}{"name": currentName},
-			NewValues:      map[string]interface{}{"name": desiredName},
-			DiffProperties: map[string]interface{}{"name": fmt.Sprintf("%s -> %s", currentName, desiredName)},
-		})
+	if change := configureChange(s.ID(), currentState, desiredState); change != nil {
+		changes = append(changes, *change)
 	}
 
 	if len(changes) == 0 {
@@ -67,21 +77,50 @@ func (s *SaltMinionResource) Diff(currentState, desiredState map[string]interfac
 }
 
 // Apply applies the changes to the system.
-func (s *SaltMinionResource) Apply(dryRun bool, changes []statemanager.Change) error {
+func (s *SaltMinionResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
 	for _, change := range changes {
 		log.Info("Applying change for Salt Minion", "change_type", change.Type, "name", s.Name, "dry_run", dryRun)
 		switch change.Type {
 		case statemanager.ChangeTypeCreate:
-			// Call the actual Salt Minion installation/configuration logic here
-			// For now, just log that it would be installed
-			if err := salt.InstallAndConfigureSalt(s.Name, dryRun, false, ""); err != nil {
+			if err := salt.InstallAndConfigureSalt(ctx, s.Name, dryRun, false, "", s.Config); err != nil {
 				return fmt.Errorf("failed to install and configure Salt Minion: %w", err)
 			}
+		case statemanager.ChangeTypeConfigure:
+			if err := salt.ConfigureMinion(ctx, s.Name, dryRun, s.Config); err != nil {
+				return fmt.Errorf("failed to configure Salt Minion: %w", err)
+			}
 		case statemanager.ChangeTypeUpdate:
 			log.Info("Salt Minion update not yet implemented.", "dry_run", dryRun)
 		case statemanager.ChangeTypeDelete:
-			log.Info("Salt Minion deletion not yet implemented.", "dry_run", dryRun)
+			if err := salt.RemoveMinion(ctx, s.Name, dryRun); err != nil {
+				return fmt.Errorf("failed to remove Salt Minion: %w", err)
+			}
 		}
 	}
 	return nil
 }
+
+// Undo reverts a change made by Apply. Configuration changes cannot be
+// reverted because the previous configuration is not kept.
+func (s *SaltMinionResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for Salt Minion", "change_type", change.Type, "name", s.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return salt.RemoveMinion(ctx, s.Name, dryRun)
+	case statemanager.ChangeTypeDelete:
+		return salt.InstallAndConfigureSalt(ctx, s.Name, dryRun, false, "", s.Config)
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name:   "salt_minion",
+		Schema: statemanager.Schema{},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &SaltMinionResource{Lifecycle: cfg.Lifecycle, ResourceID: cfg.ID, Name: cfg.Name, Config: config.AppConfig.Salt}, nil
+		},
+		DiscoverName: "minion",
+	})
+}
@@ -0,0 +1,185 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+// ServiceResource represents a systemd unit that should be enabled and
+// running, or disabled and stopped. It is restarted when a resource listed in
+// RestartOnIDs changes, such as the file resource holding its configuration.
+type ServiceResource struct {
+	statemanager.Lifecycle
+	Name         string // The systemd unit, e.g. salt-minion
+	Enabled      bool
+	Active       bool
+	RestartOnIDs []string
+}
+
+// ID returns the unique identifier for the service resource.
+func (s *ServiceResource) ID() string {
+	return fmt.Sprintf("service:%s", s.Name)
+}
+
+// DependsOn returns the declared dependencies and the resources the service
+// restarts on, since those must be applied first.
+func (s *ServiceResource) DependsOn() []string {
+	deps := append([]string(nil), s.Dependencies...)
+	for _, id := range s.RestartOnIDs {
+		if !containsString(deps, id) {
+			deps = append(deps, id)
+		}
+	}
+	return deps
+}
+
+// RestartOn returns the resources whose changes restart the service. A
+// service that should be stopped is never restarted.
+func (s *ServiceResource) RestartOn() []string {
+	if !s.Active {
+		return nil
+	}
+	return s.RestartOnIDs
+}
+
+// DesiredState returns the declared unit state.
+func (s *ServiceResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": s.Enabled,
+		"active":  s.Active,
+	}
+}
+
+// ReadCurrentState reads whether the unit is enabled and active from systemd.
+func (s *ServiceResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	log.Info("Reading current state for service", "unit", s.Name, "dry_run", dryRun)
+
+	enabled, active, err := common.ServiceStatus(ctx, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled": enabled,
+		"active":  active,
+	}, nil
+}
+
+// Diff compares the current state with the desired state and returns changes.
+func (s *ServiceResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+	if change := configureChange(s.ID(), currentState, desiredState); change != nil {
+		return []statemanager.Change{*change}, nil
+	}
+	return []statemanager.Change{{
+		Type:       statemanager.ChangeTypeNoOp,
+		ResourceID: s.ID(),
+		Details:    map[string]interface{}{"message": "No changes detected"},
+	}}, nil
+}
+
+// Apply applies the changes to the system. Only the systemctl actions needed
+// to reach the desired state are run; a service that is started is not also
+// planned for a restart.
+func (s *ServiceResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
+	for _, change := range changes {
+		log.Info("Applying change for service", "change_type", change.Type, "unit", s.Name, "dry_run", dryRun)
+		switch change.Type {
+		case statemanager.ChangeTypeConfigure, statemanager.ChangeTypeUpdate:
+			if _, ok := change.NewValues["enabled"]; ok {
+				if err := s.systemctl(ctx, dryRun, enableAction(s.Enabled)); err != nil {
+					return err
+				}
+			}
+			if _, ok := change.NewValues["active"]; ok {
+				if err := s.systemctl(ctx, dryRun, startAction(s.Active)); err != nil {
+					return err
+				}
+			}
+		case statemanager.ChangeTypeRestart:
+			if err := s.systemctl(ctx, dryRun, "restart"); err != nil {
+				return err
+			}
+		case statemanager.ChangeTypeDelete:
+			// The unit belongs to its package, so it is left as it is.
+			log.Info("Service is no longer managed, leaving it unchanged", "unit", s.Name)
+		}
+	}
+	return nil
+}
+
+// Undo reverts a change made by Apply by switching the unit back to its
+// previous state. Restarts cannot be undone.
+func (s *ServiceResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for service", "change_type", change.Type, "unit", s.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeConfigure, statemanager.ChangeTypeUpdate:
+		if enabled, ok := change.OldValues["enabled"].(bool); ok {
+			if err := s.systemctl(ctx, dryRun, enableAction(enabled)); err != nil {
+				return err
+			}
+		}
+		if active, ok := change.OldValues["active"].(bool); ok {
+			if err := s.systemctl(ctx, dryRun, startAction(active)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case statemanager.ChangeTypeDelete:
+		return nil
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func (s *ServiceResource) systemctl(ctx context.Context, dryRun bool, action string) error {
+	if err := common.Systemctl(ctx, s.Name, dryRun, action, s.Name); err != nil {
+		return fmt.Errorf("failed to %s service %s: %w", action, s.Name, err)
+	}
+	return nil
+}
+
+func enableAction(enabled bool) string {
+	if enabled {
+		return "enable"
+	}
+	return "disable"
+}
+
+func startAction(active bool) string {
+	if active {
+		return "start"
+	}
+	return "stop"
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name: "service",
+		Schema: statemanager.Schema{
+			"enabled":    {Type: statemanager.AttrBool, Default: true, Description: "Start the unit at boot"},
+			"active":     {Type: statemanager.AttrBool, Default: true, Description: "Keep the unit running"},
+			"restart_on": {Type: statemanager.AttrList, Description: "IDs of resources whose changes restart the unit, e.g. file:/etc/salt/minion"},
+		},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &ServiceResource{
+				Lifecycle:    cfg.Lifecycle,
+				Name:         cfg.Name,
+				Enabled:      cfg.Bool("enabled"),
+				Active:       cfg.Bool("active"),
+				RestartOnIDs: cfg.List("restart_on"),
+			}, nil
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package resources
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+// systemdExecutor answers systemctl queries for one unit and records the
+// systemctl actions run through sudo.
+type systemdExecutor struct {
+	common.Executor
+	mu      sync.Mutex
+	enabled bool
+	active  bool
+	actions []string
+}
+
+func (e *systemdExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case name == "systemctl" && args[0] == "is-enabled":
+		return exec.CommandContext(ctx, "echo", map[bool]string{true: "enabled", false: "disabled"}[e.enabled])
+	case name == "systemctl" && args[0] == "is-active":
+		return exec.CommandContext(ctx, "echo", map[bool]string{true: "active", false: "inactive"}[e.active])
+	case name == "sudo" && args[0] == "systemctl":
+		action := args[1]
+		e.actions = append(e.actions, action)
+		switch action {
+		case "enable":
+			e.enabled = true
+		case "start":
+			e.active = true
+		}
+		return exec.CommandContext(ctx, "true")
+	}
+	return exec.CommandContext(ctx, "false")
+}
+
+func (e *systemdExecutor) String() string { return "systemd fixture" }
+
+// changedFile is a resource that always plans a configuration change, like a
+// file resource whose content was edited.
+type changedFile struct{ statemanager.Lifecycle }
+
+func (f *changedFile) ID() string { return "file:/etc/fixture.conf" }
+
+func (f *changedFile) DesiredState() map[string]interface{} {
+	return map[string]interface{}{"checksum": "new"}
+}
+
+func (f *changedFile) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	return map[string]interface{}{"checksum": "old"}, nil
+}
+
+func (f *changedFile) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+	return []statemanager.Change{*configureChange(f.ID(), currentState, desiredState)}, nil
+}
+
+func (f *changedFile) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
+	return nil
+}
+
+func TestServiceStartedWithChangedConfigIsNotRestarted(t *testing.T) {
+	executor := &systemdExecutor{}
+	ctx := common.WithExecutor(context.Background(), executor)
+	file := &changedFile{}
+	service := &ServiceResource{Name: "fixture", Enabled: true, Active: true, RestartOnIDs: []string{file.ID()}}
+	resources := []statemanager.Resource{file, service}
+
+	sm := statemanager.NewStateManager(filepath.Join(t.TempDir(), "state.db"), false)
+	changes, err := sm.Plan(ctx, resources)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	for _, change := range changes {
+		if change.Type == statemanager.ChangeTypeRestart {
+			t.Errorf("a restart was planned for a service that is being started: %+v", change)
+		}
+	}
+	if err := sm.Apply(ctx, changes, resources); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got := strings.Join(executor.actions, ","); got != "enable,start" {
+		t.Errorf("systemctl actions = %s, want enable,start", got)
+	}
+
+	// Once running, the service is restarted when its configuration changes.
+	executor.actions = nil
+	changes, err = sm.Plan(ctx, resources)
+	if err != nil {
+		t.Fatalf("second Plan: %v", err)
+	}
+	if err := sm.Apply(ctx, changes, resources); err != nil {
+		t.Fatalf("second Apply: %v", err)
+	}
+	if got := strings.Join(executor.actions, ","); got != "restart" {
+		t.Errorf("systemctl actions = %s, want restart", got)
+	}
+}
@@ -1,8 +1,10 @@
 package resources
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/chalkan3/slothctl/internal/log"
@@ -10,13 +12,20 @@ import (
 	"github.com/chalkan3/slothctl/pkg/statemanager"
 )
 
-// UserResource represents a system user to be managed.
+// UserResource represents a system user to be managed. Empty attributes are
+// not managed, and supplementary groups are only managed if ManageGroups is set.
 type UserResource struct {
-	Username string
-	Password string // For initial creation/update, not stored in state
-	UID      string // Desired UID
-	GID      string // Desired GID
-	Shell    string // Desired shell
+	statemanager.Lifecycle
+	Username     string
+	Password     string   // For initial creation, sensitive and never stored in state
+	UID          string   // Desired UID
+	GID          string   // Desired primary group, by number or name
+	Shell        string   // Desired shell
+	Groups       []string // Desired supplementary groups, exactly
+	ManageGroups bool
+
+	// Accounts are the files users are read from; the zero value reads the system's.
+	Accounts common.AccountFiles
 }
 
 // ID returns the unique identifier for the user resource.
@@ -24,102 +33,240 @@ func (u *UserResource) ID() string {
 	return fmt.Sprintf("user:%s", u.Username)
 }
 
-// ReadCurrentState reads the current state of the user from the system.
-func (u *UserResource) ReadCurrentState(dryRun bool) (map[string]interface{}, error) {
-	log.Info("Reading current state for user", "username", u.Username, "dry_run", dryRun)
-
-	// Check if user exists
-	cmd := exec.Command("id", "-u", u.Username)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if strings.Contains(string(output), "no such user") {
-			return nil, nil // User does not exist
-		}
-		return nil, fmt.Errorf("failed to check user existence: %w", err)
+// DesiredState returns the declared configuration of the user.
+func (u *UserResource) DesiredState() map[string]interface{} {
+	state := map[string]interface{}{
+		"username": u.Username,
+		"exists":   true,
 	}
-
-	// User exists, read details
-	groupsCmd := exec.Command("id", "-Gn", u.Username)
-	groupsOutput, err := groupsCmd.CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user groups: %w", err)
+	if u.UID != "" {
+		state["uid"] = u.UID
 	}
-	currentGroups := strings.Fields(string(groupsOutput))
-	isInRootGroup := false
-	for _, group := range currentGroups {
-		if group == "root" {
-			isInRootGroup = true
-			break
-		}
+	if u.GID != "" {
+		state["gid"] = u.GID
+	}
+	if u.Shell != "" {
+		state["shell"] = u.Shell
 	}
+	if u.ManageGroups {
+		state["groups"] = sortedGroups(u.Groups)
+	}
+	return state
+}
+
+// ReadCurrentState reads the user's passwd entry and group memberships. It
+// returns nil if the user does not exist.
+func (u *UserResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	log.Info("Reading current state for user", "username", u.Username, "dry_run", dryRun)
 
+	account, err := u.accounts().LookupUser(ctx, u.Username)
+	if err != nil || account == nil {
+		return nil, err
+	}
 	return map[string]interface{}{
-		"username":    u.Username,
-		"exists":      true,
-		"inRootGroup": isInRootGroup,
+		"username":      u.Username,
+		"exists":        true,
+		"uid":           account.UID,
+		"gid":           account.GID,
+		"primary_group": account.PrimaryGroup,
+		"shell":         account.Shell,
+		"home":          account.Home,
+		"groups":        account.Groups,
 	}, nil
 }
 
 // Diff compares the current state with the desired state and returns changes.
-func (u *UserResource) Diff(currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
-	var changes []statemanager.Change
-
-	// If user does not exist in current state, plan to create
-	if currentState == nil || !currentState["exists"].(bool) {
-		newValues := map[string]interface{}{"username": u.Username, "id": common.GenerateUUID()}
+// Every declared attribute that differs is changed in a single update.
+func (u *UserResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+	if currentState == nil {
+		newValues := map[string]interface{}{"username": u.Username}
+		for key, value := range desiredState {
+			if key != "exists" {
+				newValues[key] = value
+			}
+		}
 		if u.Password != "" {
-			newValues["password"] = "[secret]" // Mask password
+			newValues["password"] = u.Password // Redacted by the state manager
 		}
-		changes = append(changes, statemanager.Change{
+		return []statemanager.Change{{
 			Type:       statemanager.ChangeTypeCreate,
 			ResourceID: u.ID(),
 			NewValues:  newValues,
-		})
-		// Also plan to add to root group if creating
-		changes = append(changes, statemanager.Change{
-			Type:       statemanager.ChangeTypeSetGroup,
-			ResourceID: u.ID(),
-			NewValues:  map[string]interface{}{"group": "root"},
-		})
-		return changes, nil
+		}}, nil
 	}
 
-	// Check if user needs to be added to root group
-	if !currentState["inRootGroup"].(bool) {
-		changes = append(changes, statemanager.Change{
-			Type:       statemanager.ChangeTypeSetGroup,
-			ResourceID: u.ID(),
-			NewValues:  map[string]interface{}{"group": "root"},
-		})
+	oldValues := make(map[string]interface{})
+	newValues := make(map[string]interface{})
+	diff := make(map[string]interface{})
+	for _, key := range []string{"uid", "gid", "shell"} {
+		want, declared := desiredState[key].(string)
+		if !declared {
+			continue
+		}
+		got, err := statemanager.StateString(currentState, key)
+		if err != nil {
+			return nil, err
+		}
+		if got == want {
+			continue
+		}
+		if key == "gid" {
+			// The primary group may be declared by name.
+			if group, _ := statemanager.StateString(currentState, "primary_group"); group == want {
+				continue
+			}
+		}
+		oldValues[key], newValues[key] = got, want
+		diff[key] = fmt.Sprintf("%s -> %s", got, want)
+	}
+	if u.ManageGroups {
+		got, err := statemanager.StateStrings(currentState, "groups")
+		if err != nil {
+			return nil, err
+		}
+		want := sortedGroups(u.Groups)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			oldValues["groups"], newValues["groups"] = got, want
+			diff["groups"] = fmt.Sprintf("%v -> %v", got, want)
+		}
 	}
 
-	return changes, nil
+	if len(diff) == 0 {
+		return []statemanager.Change{{
+			Type:       statemanager.ChangeTypeNoOp,
+			ResourceID: u.ID(),
+			Details:    map[string]interface{}{"message": "No changes detected"},
+		}}, nil
+	}
+	return []statemanager.Change{{
+		Type:           statemanager.ChangeTypeUpdate,
+		ResourceID:     u.ID(),
+		OldValues:      oldValues,
+		NewValues:      newValues,
+		DiffProperties: diff,
+	}}, nil
 }
 
 // Apply applies the changes to the system.
-func (u *UserResource) Apply(dryRun bool, changes []statemanager.Change) error {
+func (u *UserResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
 	for _, change := range changes {
 		log.Info("Applying change for user", "change_type", change.Type, "username", u.Username, "dry_run", dryRun)
 		switch change.Type {
 		case statemanager.ChangeTypeCreate:
 			// Pass a goroutine name for CreateUser
-			if err := common.CreateUser(common.GetRandomGoroutineName(), dryRun, u.Username, u.Password); err != nil {
+			if err := common.CreateUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username, u.Password, u.options()); err != nil {
 				return fmt.Errorf("failed to create user %s: %w", u.Username, err)
 			}
-		case statemanager.ChangeTypeSetGroup:
-			group := change.NewValues["group"].(string)
-			if err := common.AddUserToGroup(common.GetRandomGoroutineName(), dryRun, u.Username, group); err != nil {
-				return fmt.Errorf("failed to add user %s to group %s: %w", u.Username, group, err)
-			}
 		case statemanager.ChangeTypeUpdate:
-			// Implement user update logic here
-			log.Info("User update not yet implemented.", "username", u.Username)
+			opts, err := userOptions(change.NewValues)
+			if err != nil {
+				return err
+			}
+			if err := common.ModifyUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username, opts); err != nil {
+				return err
+			}
 		case statemanager.ChangeTypeDelete:
-			// Implement user deletion logic here
-			log.Info("User deletion not yet implemented.", "username", u.Username)
+			if err := common.DeleteUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username); err != nil {
+				return fmt.Errorf("failed to delete user %s: %w", u.Username, err)
+			}
 		case statemanager.ChangeTypeNoOp:
 			log.Info("No operation for user", "username", u.Username)
 		}
 	}
 	return nil
 }
+
+// Undo reverts a change made by Apply. An update is undone by restoring the
+// previous attributes. A deleted user is recreated with the declared password
+// and attributes, if any; its previous UID is not restored unless declared.
+func (u *UserResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for user", "change_type", change.Type, "username", u.Username, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return common.DeleteUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username)
+	case statemanager.ChangeTypeUpdate:
+		opts, err := userOptions(change.OldValues)
+		if err != nil {
+			return err
+		}
+		return common.ModifyUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username, opts)
+	case statemanager.ChangeTypeDelete:
+		return common.CreateUser(ctx, common.GetRandomGoroutineName(), dryRun, u.Username, u.Password, u.options())
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func (u *UserResource) accounts() common.AccountFiles {
+	if u.Accounts == (common.AccountFiles{}) {
+		return common.SystemAccountFiles
+	}
+	return u.Accounts
+}
+
+// options returns the declared attributes for creating the user.
+func (u *UserResource) options() common.UserOptions {
+	return common.UserOptions{UID: u.UID, GID: u.GID, Shell: u.Shell, Groups: u.Groups, SetGroups: u.ManageGroups && len(u.Groups) > 0}
+}
+
+// userOptions returns the attributes set in the values of an update.
+func userOptions(values map[string]interface{}) (common.UserOptions, error) {
+	var opts common.UserOptions
+	var err error
+	if opts.UID, err = statemanager.StateString(values, "uid"); err != nil {
+		return opts, err
+	}
+	if opts.GID, err = statemanager.StateString(values, "gid"); err != nil {
+		return opts, err
+	}
+	if opts.Shell, err = statemanager.StateString(values, "shell"); err != nil {
+		return opts, err
+	}
+	if _, ok := values["groups"]; ok {
+		opts.SetGroups = true
+		if opts.Groups, err = statemanager.StateStrings(values, "groups"); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// sortedGroups returns a sorted copy of a group list, never nil.
+func sortedGroups(groups []string) []string {
+	sorted := append([]string{}, groups...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name: "user",
+		Schema: statemanager.Schema{
+			"password":     {Type: statemanager.AttrString, Sensitive: true, Description: "Initial password"},
+			"password_env": {Type: statemanager.AttrString, Description: "Environment variable to read the password from"},
+			"uid":          {Type: statemanager.AttrString, Description: "User ID"},
+			"gid":          {Type: statemanager.AttrString, Description: "Primary group, by number or name"},
+			"shell":        {Type: statemanager.AttrString, Description: "Login shell; new users get /bin/bash if unset"},
+			"groups":       {Type: statemanager.AttrList, Description: "Supplementary groups; when set, the user is removed from any other group"},
+		},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			password := cfg.String("password")
+			// Prefer reading the password from the environment so it stays out of version control.
+			if env := cfg.String("password_env"); env != "" {
+				password = os.Getenv(env)
+				statemanager.RegisterSecret(password)
+			}
+			_, manageGroups := cfg.Attributes["groups"]
+			return &UserResource{
+				Lifecycle:    cfg.Lifecycle,
+				Username:     cfg.Name,
+				Password:     password,
+				UID:          cfg.String("uid"),
+				GID:          cfg.String("gid"),
+				Shell:        cfg.String("shell"),
+				Groups:       cfg.List("groups"),
+				ManageGroups: manageGroups,
+			}, nil
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
+	"github.com/chalkan3/slothctl/pkg/statemanager"
+)
+
+var fixtureAccounts = common.AccountFiles{PasswdPath: "testdata/passwd", GroupPath: "testdata/group"}
+
+func TestUserReadCurrentState(t *testing.T) {
+	u := &UserResource{Username: "deploy", Accounts: fixtureAccounts}
+	state, err := u.ReadCurrentState(context.Background(), false)
+	if err != nil {
+		t.Fatalf("ReadCurrentState: %v", err)
+	}
+	want := map[string]interface{}{
+		"username":      "deploy",
+		"exists":        true,
+		"uid":           "1002",
+		"gid":           "100",
+		"primary_group": "users",
+		"shell":         "/bin/sh",
+		"home":          "/home/deploy",
+		"groups":        []string{"adm", "docker"},
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+
+	missing := &UserResource{Username: "nobody-here", Accounts: fixtureAccounts}
+	if state, err := missing.ReadCurrentState(context.Background(), false); err != nil || state != nil {
+		t.Errorf("missing user: state = %v, err = %v, want nil, nil", state, err)
+	}
+}
+
+func TestUserDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     UserResource
+		wantType statemanager.ChangeType
+		wantDiff []string
+	}{
+		{
+			name:     "matching attributes",
+			user:     UserResource{Username: "saltuser", UID: "1001", GID: "saltuser", Shell: "/bin/bash", Groups: []string{"wheel", "docker"}, ManageGroups: true},
+			wantType: statemanager.ChangeTypeNoOp,
+		},
+		{
+			name:     "unmanaged groups are left alone",
+			user:     UserResource{Username: "saltuser", Shell: "/bin/bash"},
+			wantType: statemanager.ChangeTypeNoOp,
+		},
+		{
+			name:     "every declared attribute differs",
+			user:     UserResource{Username: "deploy", UID: "2000", GID: "1001", Shell: "/bin/zsh", Groups: []string{"docker"}, ManageGroups: true},
+			wantType: statemanager.ChangeTypeUpdate,
+			wantDiff: []string{"gid", "groups", "shell", "uid"},
+		},
+		{
+			name:     "empty group list removes all groups",
+			user:     UserResource{Username: "deploy", ManageGroups: true},
+			wantType: statemanager.ChangeTypeUpdate,
+			wantDiff: []string{"groups"},
+		},
+		{
+			name:     "missing user is created",
+			user:     UserResource{Username: "newuser", Shell: "/bin/bash"},
+			wantType: statemanager.ChangeTypeCreate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := tt.user
+			u.Accounts = fixtureAccounts
+			current, err := u.ReadCurrentState(context.Background(), false)
+			if err != nil {
+				t.Fatalf("ReadCurrentState: %v", err)
+			}
+			changes, err := u.Diff(context.Background(), current, u.DesiredState())
+			if err != nil {
+				t.Fatalf("Diff: %v", err)
+			}
+			if len(changes) != 1 || changes[0].Type != tt.wantType {
+				t.Fatalf("changes = %+v, want a single %s", changes, tt.wantType)
+			}
+			var diff []string
+			for key := range changes[0].DiffProperties {
+				diff = append(diff, key)
+			}
+			if !reflect.DeepEqual(sortedGroups(diff), sortedGroups(tt.wantDiff)) {
+				t.Errorf("changed properties = %v, want %v", diff, tt.wantDiff)
+			}
+		})
+	}
+}
+
+func TestParsePasswdRejectsMalformedLines(t *testing.T) {
+	files := common.AccountFiles{PasswdPath: "testdata/group", GroupPath: "testdata/group"}
+	if _, err := files.LookupUser(context.Background(), "root"); err == nil {
+		t.Error("LookupUser on a group file as passwd: expected an error")
+	}
+}
@@ -1,15 +1,21 @@
 package resources
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/chalkan3/slothctl/internal/log"
+	"github.com/chalkan3/slothctl/pkg/bootstrap/common"
 	"github.com/chalkan3/slothctl/pkg/bootstrap/vault"
 	"github.com/chalkan3/slothctl/pkg/statemanager"
 )
 
+// vaultPort is the port of the Vault listener configured by bootstrap.
+const vaultPort = 8200
+
 // VaultResource represents a HashiCorp Vault instance.
 type VaultResource struct {
+	statemanager.Lifecycle
 	ResourceID string
 	Name       string
 	// Add more Vault-specific attributes here (e.g., version, config path, address)
@@ -20,52 +26,87 @@ func (v *VaultResource) ID() string {
 	return fmt.Sprintf("vault:%s", v.Name)
 }
 
-// ReadCurrentState reads the current state of the Vault instance from the system.
-func (v *VaultResource) ReadCurrentState(dryRun bool) (map[string]interface{}, error) {
+// DesiredState returns the declared configuration of the Vault instance.
+func (v *VaultResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{
+		"name":            v.Name,
+		"installed":       true,
+		"enabled":         true,
+		"active":          true,
+		"config_checksum": common.Checksum([]byte(vault.ConfigContent())),
+		"listener":        vault.ListenerAddress,
+		"certificate":     string(vault.CertificateValid),
+	}
+}
+
+// ReadCurrentState reads the current state of the Vault instance from the system:
+// package version, service state, configuration checksum, listener address,
+// whether its TLS certificate needs renewing and the sealed/initialized status
+// reported by the Vault API.
+func (v *VaultResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
 	log.Info("Reading current state for Vault", "name", v.Name, "dry_run", dryRun)
-	// Simplified: In a real scenario, you'd check if Vault is installed, running, and get its config.
-	// For now, assume it doesn't exist if we are planning to create it.
-	return nil, nil // Assume it doesn't exist for now to always plan creation
+
+	state, err := probeService(ctx, vault.PackageName, vault.ServiceName, vault.ConfigPath)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	state["name"] = v.Name
+
+	listener := ""
+	addresses, err := common.ListeningAddresses(ctx, vaultPort)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) > 0 {
+		listener = addresses[0]
+	}
+	state["listener"] = listener
+
+	certificate, _, err := vault.GetCertificateStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state["certificate"] = string(certificate)
+
+	status, err := vault.GetSealStatus(ctx, vault.Address(common.ExecutorFrom(ctx).Host()))
+	if err != nil {
+		log.Warn("Could not read Vault seal status", "name", v.Name, "error", err)
+		state["reachable"] = false
+	} else {
+		state["reachable"] = true
+		state["initialized"] = status.Initialized
+		state["sealed"] = status.Sealed
+	}
+
+	return state, nil
 }
 
 // Diff compares the current state with the desired state and returns changes.
-func (v *VaultResource) Diff(currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
+func (v *VaultResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]statemanager.Change, error) {
 	var changes []statemanager.Change
 
 	if currentState == nil {
 		changes = append(changes, statemanager.Change{
 			Type:       statemanager.ChangeTypeCreate,
 			ResourceID: v.ID(),
-			NewValues:  map[string]interface{}{"name": v.Name, "id": v.ResourceID},
-		})
-		changes = append(changes, statemanager.Change{
-			Type:       statemanager.ChangeTypeConfigure,
-			ResourceID: v.ID(),
-			NewValues:  map[string]interface{}{"address": "0.0.0.0:8200", "ui_enabled": true, "kind": "hashcorp-vault", "id": v.ResourceID},
+			NewValues:  map[string]interface{}{"name": v.Name, "id": v.ResourceID, "kind": "hashicorp-vault", "address": vault.ListenerAddress, "ui_enabled": true},
 		})
 		return changes, nil
 	}
 
-	// For simplicity, assume only 'name' can be updated for now.
-	// In a real scenario, you'd compare all relevant attributes.
-	currentName := currentState["name"].(string)
-	desiredName := desiredState["name"].(string)
-
-	if currentName != desiredName {
-		changes = append(changes, statemanager.Change{
-			Type:           statemanager.ChangeTypeUpdate,
-			ResourceID:     v.ID(),
-			OldValues:      map[string]interface{}{"name": currentName},
-			NewValues:      map[string]interface{}{"name": desiredName},
-			DiffProperties: map[string]interface{}{"name": fmt.Sprintf("%s -> %s", currentName, desiredName)},
-		})
+	if change := configureChange(v.ID(), currentState, desiredState); change != nil {
+		changes = append(changes, *change)
 	}
 
 	if len(changes) == 0 {
+		details := map[string]interface{}{"message": "No changes detected"}
+		if sealed, _ := statemanager.StateBool(currentState, "sealed"); sealed {
+			details["warning"] = "Vault is sealed and must be unsealed before use"
+		}
 		changes = append(changes, statemanager.Change{
 			Type:       statemanager.ChangeTypeNoOp,
 			ResourceID: v.ID(),
-			Details:    map[string]interface{}{"message": "No changes detected"},
+			Details:    details,
 		})
 	}
 
@@ -73,23 +114,50 @@ func (v *VaultResource) Diff(currentState, desiredState map[string]interface{})
 }
 
 // Apply applies the changes to the system.
-func (v *VaultResource) Apply(dryRun bool, changes []statemanager.Change) error {
+func (v *VaultResource) Apply(ctx context.Context, dryRun bool, changes []statemanager.Change) error {
 	for _, change := range changes {
 		log.Info("Applying change for Vault", "change_type", change.Type, "name", v.Name, "dry_run", dryRun)
 		switch change.Type {
 		case statemanager.ChangeTypeCreate:
-			// Call the actual Vault installation/configuration logic here
-			// For now, just log that it would be installed
-			if err := vault.InstallAndConfigureVault(v.Name, dryRun); err != nil {
+			if err := vault.InstallAndConfigureVault(ctx, v.Name, dryRun); err != nil {
 				return fmt.Errorf("failed to install and configure Vault: %w", err)
 			}
 		case statemanager.ChangeTypeConfigure:
-			log.Info("Vault configuration would be performed here.", "dry_run", dryRun, "attributes", change.NewValues)
+			if err := vault.ConfigureVault(ctx, v.Name, dryRun); err != nil {
+				return fmt.Errorf("failed to configure Vault: %w", err)
+			}
 		case statemanager.ChangeTypeUpdate:
 			log.Info("Vault update not yet implemented.", "dry_run", dryRun)
 		case statemanager.ChangeTypeDelete:
-			log.Info("Vault deletion not yet implemented.", "dry_run", dryRun)
+			if err := vault.RemoveVault(ctx, v.Name, dryRun); err != nil {
+				return fmt.Errorf("failed to remove Vault: %w", err)
+			}
 		}
 	}
 	return nil
 }
+
+// Undo reverts a change made by Apply. Configuration changes cannot be
+// reverted because the previous configuration is not kept.
+func (v *VaultResource) Undo(ctx context.Context, dryRun bool, change statemanager.Change) error {
+	log.Info("Undoing change for Vault", "change_type", change.Type, "name", v.Name, "dry_run", dryRun)
+	switch change.Type {
+	case statemanager.ChangeTypeCreate:
+		return vault.RemoveVault(ctx, v.Name, dryRun)
+	case statemanager.ChangeTypeDelete:
+		return vault.InstallAndConfigureVault(ctx, v.Name, dryRun)
+	default:
+		return statemanager.ErrUndoUnsupported
+	}
+}
+
+func init() {
+	statemanager.RegisterKind(statemanager.Kind{
+		Name:   "vault",
+		Schema: statemanager.Schema{},
+		New: func(cfg statemanager.ResourceConfig) (statemanager.Resource, error) {
+			return &VaultResource{Lifecycle: cfg.Lifecycle, ResourceID: cfg.ID, Name: cfg.Name}, nil
+		},
+		DiscoverName: "main",
+	})
+}
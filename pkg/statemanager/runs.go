@@ -0,0 +1,110 @@
+package statemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chalkan3/slothctl/internal/log"
+	"go.etcd.io/bbolt"
+)
+
+// RunsBucket holds one record per apply, keyed by run number.
+const RunsBucket = "slothctl_runs"
+
+// RunOutcome is how an apply ended.
+type RunOutcome string
+
+const (
+	RunSucceeded      RunOutcome = "succeeded"
+	RunFailed         RunOutcome = "failed"
+	RunInterrupted    RunOutcome = "interrupted"
+	RunRolledBack     RunOutcome = "rolled-back"
+	RunRollbackFailed RunOutcome = "rollback-failed" // Some completed changes could not be undone
+)
+
+// RunFailure is a resource that failed during an apply or its rollback.
+type RunFailure struct {
+	ResourceID string `json:"resource_id"`
+	Stage      string `json:"stage"` // "apply" or "undo"
+	Error      string `json:"error"`
+}
+
+// RunRecord describes one apply and what it left behind.
+type RunRecord struct {
+	ID          uint64       `json:"id"`
+	StartedAt   time.Time    `json:"started_at"`
+	FinishedAt  time.Time    `json:"finished_at"`
+	User        string       `json:"user"`
+	Host        string       `json:"host"`
+	FailureMode FailureMode  `json:"failure_mode"`
+	Outcome     RunOutcome   `json:"outcome"`
+	Applied     []Change     `json:"applied,omitempty"` // Changes that completed, in order
+	Undone      []Change     `json:"undone,omitempty"`  // Changes reverted by a rollback, newest first
+	Failures    []RunFailure `json:"failures,omitempty"`
+	Skipped     []string     `json:"skipped,omitempty"` // Resources not applied because of a failure or interrupt
+}
+
+// Failed reports whether the run did not converge every resource.
+func (r *RunRecord) Failed() bool {
+	return r.Outcome != RunSucceeded
+}
+
+// FailureFor returns the apply failure of a resource in this run, if any.
+func (r *RunRecord) FailureFor(resourceID string) (RunFailure, bool) {
+	for _, failure := range r.Failures {
+		if failure.ResourceID == resourceID && failure.Stage == "apply" {
+			return failure, true
+		}
+	}
+	return RunFailure{}, false
+}
+
+// recordRun persists a run record, assigning its ID.
+func (sm *StateManager) recordRun(run *RunRecord) error {
+	run.User = currentUser()
+	run.Host, _ = os.Hostname()
+	run.Applied = redactChanges(run.Applied)
+	run.Undone = redactChanges(run.Undone)
+	for i := range run.Failures {
+		run.Failures[i].Error = log.Redact(run.Failures[i].Error)
+	}
+	return sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(RunsBucket))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("allocate run number: %w", err)
+		}
+		run.ID = id
+		data, err := json.Marshal(run)
+		if err != nil {
+			return fmt.Errorf("marshal run: %w", err)
+		}
+		return b.Put(versionKey(id), data)
+	})
+}
+
+// LastRun returns the most recent apply, or nil if nothing was applied yet.
+func (sm *StateManager) LastRun() (*RunRecord, error) {
+	var run *RunRecord
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(RunsBucket))
+		if b == nil {
+			return nil
+		}
+		_, data := b.Cursor().Last()
+		if data == nil {
+			return nil
+		}
+		run = &RunRecord{}
+		return json.Unmarshal(data, run)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last run: %w", err)
+	}
+	return run, nil
+}
@@ -0,0 +1,126 @@
+package statemanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+// RedactedValue replaces sensitive values in plans, plan files and logs.
+const RedactedValue = log.RedactedValue
+
+// sensitiveHashPrefix marks a sensitive value that was replaced by its hash in
+// the recorded state. The hash still shows when a secret changed.
+const sensitiveHashPrefix = "sha256:"
+
+// Sensitive is implemented by resources with sensitive attributes. Values under
+// these keys are redacted from plans and logs and hashed in the recorded state.
+type Sensitive interface {
+	SensitiveKeys() []string
+}
+
+// RegisterSecret marks a value as secret for the rest of the process, so it is
+// redacted wherever it shows up. Kinds register the sensitive attributes of a
+// manifest automatically; constructors must register secrets they obtain
+// elsewhere, such as from the environment.
+func RegisterSecret(value string) {
+	log.RegisterSecret(value)
+}
+
+// sensitiveKeys returns the sensitive keys of a resource.
+func sensitiveKeys(res Resource) map[string]bool {
+	keys := make(map[string]bool)
+	if s, ok := res.(Sensitive); ok {
+		for _, key := range s.SensitiveKeys() {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// redactChange returns a copy of a change with sensitive values replaced by
+// RedactedValue, so it can be shown, saved or logged.
+func redactChange(change Change, keys map[string]bool) Change {
+	mask := func(string) string { return RedactedValue }
+	change.NewValues = redactMap(change.NewValues, keys, mask)
+	change.OldValues = redactMap(change.OldValues, keys, mask)
+	change.DiffProperties = redactMap(change.DiffProperties, keys, mask)
+	change.DriftProperties = redactMap(change.DriftProperties, keys, mask)
+	change.Details = redactMap(change.Details, keys, mask)
+	return change
+}
+
+// redactChanges redacts registered secrets from a list of changes.
+func redactChanges(changes []Change) []Change {
+	if changes == nil {
+		return nil
+	}
+	redacted := make([]Change, len(changes))
+	for i, change := range changes {
+		redacted[i] = redactChange(change, nil)
+	}
+	return redacted
+}
+
+// protectState returns a copy of a state map that is safe to persist:
+// sensitive values are replaced by their hash.
+func protectState(state map[string]interface{}, keys map[string]bool) map[string]interface{} {
+	return redactMap(state, keys, hashSecret)
+}
+
+// hashSecret returns the hash stored in place of a sensitive value.
+func hashSecret(value string) string {
+	if strings.HasPrefix(value, sensitiveHashPrefix) {
+		return value // Already protected, e.g. when a recorded state is rolled back
+	}
+	sum := sha256.Sum256([]byte(value))
+	return sensitiveHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// redactMap returns a copy of values in which values under sensitive keys and
+// registered secrets are replaced using mask. Secrets embedded in longer
+// strings, such as command lines, are replaced by RedactedValue.
+func redactMap(values map[string]interface{}, keys map[string]bool, mask func(string) string) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if keys[key] && value != nil {
+			redacted[key] = mask(fmt.Sprintf("%v", value))
+			continue
+		}
+		redacted[key] = redactValue(value, keys, mask)
+	}
+	return redacted
+}
+
+// redactValue redacts a single value, descending into nested maps and lists.
+func redactValue(value interface{}, keys map[string]bool, mask func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if log.IsSecret(v) {
+			return mask(v)
+		}
+		return log.Redact(v)
+	case map[string]interface{}:
+		return redactMap(v, keys, mask)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = redactValue(item, keys, mask)
+		}
+		return list
+	case []string:
+		list := make([]string, len(v))
+		for i, item := range v {
+			list[i] = redactValue(item, keys, mask).(string)
+		}
+		return list
+	default:
+		return value
+	}
+}
@@ -0,0 +1,154 @@
+package statemanager
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+const testSecret = "s3cr3t-token-value"
+
+// secretResource is a resource that leaks its sensitive token everywhere it
+// can: in planned changes, details, its live state and its log output.
+type secretResource struct {
+	Lifecycle
+	name    string
+	token   string
+	applied bool
+}
+
+func (r *secretResource) ID() string { return "secret_fixture:" + r.name }
+
+func (r *secretResource) DesiredState() map[string]interface{} {
+	return map[string]interface{}{"exists": true, "token": r.token}
+}
+
+func (r *secretResource) ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error) {
+	log.Debug("Reading secret fixture", "token", r.token)
+	if !r.applied {
+		return nil, nil
+	}
+	return map[string]interface{}{"exists": true, "token": r.token}, nil
+}
+
+func (r *secretResource) Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]Change, error) {
+	if currentState != nil {
+		return []Change{{Type: ChangeTypeNoOp, ResourceID: r.ID()}}, nil
+	}
+	return []Change{{
+		Type:       ChangeTypeCreate,
+		ResourceID: r.ID(),
+		NewValues:  map[string]interface{}{"token": r.token, "args": []interface{}{"--token", r.token}},
+		Details:    map[string]interface{}{"command": "setup --token=" + r.token},
+	}}, nil
+}
+
+func (r *secretResource) Apply(ctx context.Context, dryRun bool, changes []Change) error {
+	for _, change := range changes {
+		log.Info("Applying secret fixture", "change", change, "command", "setup --token="+r.token)
+	}
+	r.applied = true
+	return nil
+}
+
+func secretKind() Kind {
+	if kind, ok := LookupKind("secret_fixture"); ok {
+		return kind
+	}
+	kind := Kind{
+		Name:   "secret_fixture",
+		Schema: Schema{"token": {Type: AttrString, Sensitive: true}},
+		New: func(cfg ResourceConfig) (Resource, error) {
+			return &secretResource{Lifecycle: cfg.Lifecycle, name: cfg.Name, token: cfg.String("token")}, nil
+		},
+	}
+	RegisterKind(kind)
+	return kind
+}
+
+func TestSensitiveValuesNeverPersistedOrLogged(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetDefaultLogger(log.NewLogger(&log.Options{Level: slog.LevelDebug, Format: log.FormatText, Output: &logs}))
+	defer log.SetDefaultLogger(log.NewLogger(nil))
+
+	res, err := secretKind().Build("main", "", Lifecycle{}, map[string]interface{}{"token": testSecret})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "state.db")
+	sm := NewStateManager(dbPath, false)
+	ctx := context.Background()
+
+	changes, err := sm.Plan(ctx, []Resource{res})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if len(changes) != 1 || changes[0].NewValues["token"] != RedactedValue {
+		t.Fatalf("planned change does not redact the token: %+v", changes)
+	}
+
+	var rendered, planJSON bytes.Buffer
+	RenderChanges(&rendered, changes, false)
+	if err := WritePlanJSON(&planJSON, changes); err != nil {
+		t.Fatalf("WritePlanJSON: %v", err)
+	}
+	planPath := filepath.Join(dir, "plan.json")
+	if err := WritePlanFile(planPath, &SavedPlan{FormatVersion: PlanFormatVersion, Changes: changes}); err != nil {
+		t.Fatalf("WritePlanFile: %v", err)
+	}
+	planFile, err := os.ReadFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sm.Apply(ctx, changes, []Resource{res}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	// A second plan compares the live token with the recorded hash and must
+	// neither report drift nor plan a change.
+	changes, err = sm.Plan(ctx, []Resource{res})
+	if err != nil {
+		t.Fatalf("second Plan: %v", err)
+	}
+	for _, change := range changes {
+		if change.Type != ChangeTypeNoOp {
+			t.Errorf("second plan is not empty: %+v", change)
+		}
+	}
+
+	state, err := sm.ReadState(res.ID())
+	if err != nil {
+		t.Fatalf("ReadState: %v", err)
+	}
+	if token, _ := state["token"].(string); !strings.HasPrefix(token, sensitiveHashPrefix) {
+		t.Errorf("recorded token = %q, want a %s hash", token, sensitiveHashPrefix)
+	}
+
+	db, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, output := range map[string][]byte{
+		"state database": db,
+		"log output":     logs.Bytes(),
+		"rendered plan":  rendered.Bytes(),
+		"JSON plan":      planJSON.Bytes(),
+		"plan file":      planFile,
+	} {
+		if bytes.Contains(output, []byte(testSecret)) {
+			t.Errorf("secret value found in %s", name)
+		}
+	}
+	if !strings.Contains(logs.String(), RedactedValue) {
+		t.Errorf("log output does not show the redacted token:\n%s", logs.String())
+	}
+}
@@ -1,9 +1,13 @@
 package statemanager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/chalkan3/slothctl/internal/log"
 	"go.etcd.io/bbolt"
@@ -12,9 +16,12 @@ import (
 // Resource is the interface that all managed resources must implement.
 type Resource interface {
 	ID() string
-	ReadCurrentState(dryRun bool) (map[string]interface{}, error)
-	Diff(currentState, desiredState map[string]interface{}) ([]Change, error)
-	Apply(dryRun bool, changes []Change) error
+	// DesiredState returns the declared configuration of the resource, shaped like
+	// the map returned by ReadCurrentState so the two can be compared.
+	DesiredState() map[string]interface{}
+	ReadCurrentState(ctx context.Context, dryRun bool) (map[string]interface{}, error)
+	Diff(ctx context.Context, currentState, desiredState map[string]interface{}) ([]Change, error)
+	Apply(ctx context.Context, dryRun bool, changes []Change) error
 }
 
 // ChangeType defines the type of change to a resource.
@@ -25,36 +32,104 @@ const (
 	ChangeTypeUpdate    ChangeType = "update"
 	ChangeTypeDelete    ChangeType = "delete"
 	ChangeTypeNoOp      ChangeType = "no-op"
-	ChangeTypeSetGroup  ChangeType = "set-group"
 	ChangeTypeConfigure ChangeType = "configure"
+	ChangeTypeRestart   ChangeType = "restart" // Planned for subscribers of a changed resource
+)
+
+// ChangeOrigin explains why a change was planned.
+type ChangeOrigin string
+
+const (
+	// OriginDesired marks a change caused by a new or edited desired configuration.
+	OriginDesired ChangeOrigin = "desired"
+	// OriginDrift marks a change caused by the live system diverging from the last
+	// applied state, e.g. someone editing the host behind slothctl's back.
+	OriginDrift ChangeOrigin = "drift"
 )
 
 // Change represents a planned or applied modification to a resource.
 type Change struct {
-	Type           ChangeType             `json:"type"`
-	ResourceID     string                 `json:"resource_id"`
-	NewValues      map[string]interface{} `json:"new_values,omitempty"`      // For create and update
-	OldValues      map[string]interface{} `json:"old_values,omitempty"`      // For update and delete
-	DiffProperties map[string]interface{} `json:"diff_properties,omitempty"` // Properties that changed
-	Details        map[string]interface{} `json:"details,omitempty"`         // General details about the change
+	Type            ChangeType             `json:"type"`
+	ResourceID      string                 `json:"resource_id"`
+	Origin          ChangeOrigin           `json:"origin,omitempty"`
+	NewValues       map[string]interface{} `json:"new_values,omitempty"`       // For create and update
+	OldValues       map[string]interface{} `json:"old_values,omitempty"`       // For update and delete
+	DiffProperties  map[string]interface{} `json:"diff_properties,omitempty"`  // Properties that changed
+	DriftProperties map[string]interface{} `json:"drift_properties,omitempty"` // Properties changed out-of-band since the last apply
+	Details         map[string]interface{} `json:"details,omitempty"`          // General details about the change
 }
 
+// dbOpenTimeout bounds how long a transaction waits for another process to
+// release the BoltDB file. Processes only hold the file for single transactions,
+// so this is short; long-running operations are serialized by the state lock.
+const dbOpenTimeout = 10 * time.Second
+
+// stateReadTimeout bounds reading the state of a resource after it was applied.
+const stateReadTimeout = 2 * time.Minute
+
+// ErrInterrupted is returned for resources that were stopped or not started
+// because the apply was cancelled.
+var ErrInterrupted = errors.New("apply interrupted")
+
 // StateManager manages the desired and current state of resources.
 type StateManager struct {
-	db     *bbolt.DB
-	dryRun bool
+	dbPath      string
+	dbMu        sync.Mutex // Serializes database access within this process
+	dryRun      bool
+	parallelism int
+
+	resolver     ResourceResolver // Rebuilds resources that are only in the recorded state
+	allowDestroy bool             // Whether Apply may execute delete changes
+	failureMode  FailureMode      // What Apply does when a resource fails
+
+	lockMu     sync.Mutex
+	lock       *LockInfo               // Lock held by this manager, if any
+	lockDepth  int                     // Number of nested Lock calls
+	lockStop   chan struct{}           // Stops the lock heartbeat
+	lockCancel context.CancelCauseFunc // Cancels the context of the outermost Lock
+}
+
+// NewStateManager creates a new StateManager instance backed by the BoltDB file
+// at dbPath. The file is opened for each transaction rather than for the whole
+// run, so concurrent slothctl processes see each other's state lock instead of
+// failing to open the database.
+func NewStateManager(dbPath string, dryRun bool) *StateManager {
+	return &StateManager{dbPath: dbPath, dryRun: dryRun, parallelism: DefaultParallelism, failureMode: FailureStop}
+}
+
+// view runs a read-only transaction against the state database.
+func (sm *StateManager) view(fn func(tx *bbolt.Tx) error) error {
+	return sm.withDB(func(db *bbolt.DB) error { return db.View(fn) })
 }
 
-// NewStateManager creates a new StateManager instance.
-func NewStateManager(db *bbolt.DB, dryRun bool) *StateManager {
-	return &StateManager{db: db, dryRun: dryRun}
+// update runs a read-write transaction against the state database.
+func (sm *StateManager) update(fn func(tx *bbolt.Tx) error) error {
+	return sm.withDB(func(db *bbolt.DB) error { return db.Update(fn) })
+}
+
+// withDB opens the database, runs fn and closes it again.
+func (sm *StateManager) withDB(fn func(db *bbolt.DB) error) error {
+	sm.dbMu.Lock()
+	defer sm.dbMu.Unlock()
+
+	db, err := bbolt.Open(sm.dbPath, 0600, &bbolt.Options{Timeout: dbOpenTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to open BoltDB %s: %w", sm.dbPath, err)
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// SetParallelism sets how many independent resources Apply may change concurrently.
+func (sm *StateManager) SetParallelism(parallelism int) {
+	sm.parallelism = parallelism
 }
 
 // ReadState reads the current state of a resource from the BoltDB.
 func (sm *StateManager) ReadState(resourceID string) (map[string]interface{}, error) {
 	var state map[string]interface{}
-	err := sm.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("slothctl_state"))
+	err := sm.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(StateBucket))
 		if b == nil {
 			return nil // Bucket doesn't exist yet, no state saved
 		}
@@ -70,10 +145,12 @@ func (sm *StateManager) ReadState(resourceID string) (map[string]interface{}, er
 	return state, nil
 }
 
-// WriteState writes the current state of a resource to the BoltDB.
+// WriteState writes the current state of a resource to the BoltDB. Registered
+// secrets are stored only as hashes.
 func (sm *StateManager) WriteState(resourceID string, state map[string]interface{}) error {
-	return sm.db.Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("slothctl_state"))
+	state = protectState(state, nil)
+	return sm.update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(StateBucket))
 		if err != nil {
 			return fmt.Errorf("create bucket: %w", err)
 		}
@@ -85,85 +162,358 @@ func (sm *StateManager) WriteState(resourceID string, state map[string]interface
 	})
 }
 
-// Plan compares the desired state with the current state and generates a plan of changes.
-func (sm *StateManager) Plan(desiredResources []Resource) ([]Change, error) {
+// Plan performs a three-way comparison between the desired configuration, the
+// last-applied state recorded in BoltDB and the live state of the system, and
+// generates a plan of changes. Each change is classified as either a new desired
+// change or out-of-band drift.
+//
+// Each resource is read within its timeout. Planning stops when ctx is cancelled.
+func (sm *StateManager) Plan(ctx context.Context, desiredResources []Resource) ([]Change, error) {
+	ctx, err := sm.Lock(ctx, "plan", 0)
+	if err != nil {
+		return nil, err
+	}
+	defer sm.Unlock()
+	return sm.plan(ctx, desiredResources)
+}
+
+// PlanUnlocked is Plan without taking the state lock, for read-only checks
+// such as the drift daemon's that must not make operators wait for them. A run
+// holding the lock may change the recorded state while the plan is made, so
+// callers check CurrentLock and LastRun before recording anything from it.
+func (sm *StateManager) PlanUnlocked(ctx context.Context, desiredResources []Resource) ([]Change, error) {
+	return sm.plan(ctx, desiredResources)
+}
+
+func (sm *StateManager) plan(ctx context.Context, desiredResources []Resource) ([]Change, error) {
 	log.Info("Generating execution plan...")
 	var allChanges []Change
 
-	for _, desiredRes := range desiredResources {
-		resourceID := desiredRes.ID()
-		log.Info("Planning for resource", "id", resourceID, "type", reflect.TypeOf(desiredRes).Elem().Name())
+	// Report how the previous apply ended, so a half-finished run is not mistaken for drift.
+	lastRun, err := sm.LastRun()
+	if err != nil {
+		log.Warn("Could not read the outcome of the previous apply", "error", err)
+	}
+	if lastRun != nil && lastRun.Failed() {
+		log.Warn("The previous apply did not complete", "run", lastRun.ID, "outcome", lastRun.Outcome,
+			"finished_at", lastRun.FinishedAt, "user", lastRun.User, "failures", len(lastRun.Failures), "undone", len(lastRun.Undone))
+	}
 
-		// Read current state from system
-		currentState, err := desiredRes.ReadCurrentState(sm.dryRun)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read current state for %s: %w", resourceID, err)
-		}
+	// Plan in dependency order so the plan reads the way it will be applied.
+	g, err := buildGraph(desiredResources, nil)
+	if err != nil {
+		return nil, err
+	}
 
-		// For simplicity, we'll use desiredState as the source of truth for diffing against current.
-		// A more complex state manager would diff desired vs. lastKnown, and then current vs. desired.
-		desiredStateForDiff, err := desiredRes.ReadCurrentState(true) // Read desired state for diffing (no side effects)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read desired state for diffing for %s: %w", resourceID, err)
+	for _, resourceID := range g.order {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("planning interrupted: %w", context.Cause(ctx))
 		}
-
-		changes, err := desiredRes.Diff(currentState, desiredStateForDiff)
+		changes, err := sm.planResource(ctx, g.nodes[resourceID])
 		if err != nil {
-			return nil, fmt.Errorf("failed to diff resource %s: %w", resourceID, err)
+			return nil, err
 		}
+		// Subscribed resources come first in dependency order, so their
+		// changes are already planned.
+		changes = planRestart(g.nodes[resourceID], changes, allChanges, g.nodes)
+		annotatePreviousFailure(changes, lastRun)
+		allChanges = append(allChanges, changes...)
+	}
+
+	// Resources recorded by an earlier apply but no longer desired are deleted.
+	deletes, err := sm.planOrphans(ctx, desiredResources)
+	if err != nil {
+		return nil, err
+	}
+	allChanges = append(allChanges, deletes...)
+
+	log.Info("Execution plan generated.", "total_changes", len(allChanges))
+	return allChanges, nil
+}
 
-		if len(changes) == 0 {
-			log.Info("No changes detected for resource", "id", resourceID)
+// annotatePreviousFailure marks the changes of a resource that failed in the
+// previous apply with that failure.
+func annotatePreviousFailure(changes []Change, lastRun *RunRecord) {
+	if lastRun == nil {
+		return
+	}
+	for i := range changes {
+		failure, ok := lastRun.FailureFor(changes[i].ResourceID)
+		if !ok || changes[i].Type == ChangeTypeNoOp {
 			continue
 		}
+		if changes[i].Details == nil {
+			changes[i].Details = make(map[string]interface{})
+		}
+		changes[i].Details["previous_failure"] = fmt.Sprintf("run %d (%s): %s", lastRun.ID, lastRun.Outcome, failure.Error)
+	}
+}
 
-		log.Info("Changes planned for resource", "id", resourceID, "changes_count", len(changes))
-		allChanges = append(allChanges, changes...)
+// planResource compares the desired, last-applied and live state of a single
+// resource within the resource's timeout.
+func (sm *StateManager) planResource(ctx context.Context, desiredRes Resource) ([]Change, error) {
+	resourceID := desiredRes.ID()
+	log.Info("Planning for resource", "id", resourceID, "type", reflect.TypeOf(desiredRes).Elem().Name())
+
+	timeout := resourceTimeout(desiredRes)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Read the state recorded by the last successful apply
+	lastApplied, err := sm.ReadState(resourceID)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Info("Execution plan generated.", "total_changes", len(allChanges))
-	return allChanges, nil
+	// Read current state from system
+	currentState, err := desiredRes.ReadCurrentState(ctx, sm.dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current state for %s: %w", resourceID, timeoutError(ctx, timeout, err))
+	}
+
+	desiredState := desiredRes.DesiredState()
+
+	changes, err := desiredRes.Diff(ctx, currentState, desiredState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff resource %s: %w", resourceID, timeoutError(ctx, timeout, err))
+	}
+
+	// The recorded state holds hashes of sensitive values, so compare it with
+	// the live and desired state protected the same way.
+	keys := sensitiveKeys(desiredRes)
+	drift := driftedProperties(lastApplied, protectState(currentState, keys))
+	if len(drift) > 0 {
+		log.Warn("Out-of-band drift detected for resource", "id", resourceID, "properties", drift)
+	}
+	edited := editedProperties(lastApplied, protectState(desiredState, keys))
+	for i := range changes {
+		classifyChange(&changes[i], lastApplied, drift, edited)
+		changes[i] = redactChange(changes[i], keys)
+	}
+
+	if len(changes) == 0 {
+		log.Info("No changes detected for resource", "id", resourceID)
+		return nil, nil
+	}
+
+	log.Info("Changes planned for resource", "id", resourceID, "changes_count", len(changes))
+	return changes, nil
 }
 
 // Apply applies the planned changes to the system and updates the state in BoltDB.
-func (sm *StateManager) Apply(changes []Change, desiredResources []Resource) error {
-	log.Info("Applying changes...", "total_changes", len(changes), "dry_run", sm.dryRun)
+// Resources are applied in dependency order; independent resources run
+// concurrently up to the configured parallelism, and resources whose
+// dependencies failed are skipped. What happens to the rest of the run when a
+// resource fails depends on the failure mode, and the outcome is recorded so
+// the next plan can report it.
+//
+// Cancelling ctx, e.g. on Ctrl-C, lets the running steps finish, records the
+// state they left behind and starts no further steps. Commands that exceed the
+// resource timeout are terminated.
+func (sm *StateManager) Apply(ctx context.Context, changes []Change, desiredResources []Resource) error {
+	ctx, err := sm.Lock(ctx, "apply", 0)
+	if err != nil {
+		return err
+	}
+	defer sm.Unlock()
+
+	log.Info("Applying changes...", "total_changes", len(changes), "dry_run", sm.dryRun, "parallelism", sm.parallelism)
+
+	// Deleted resources are no longer desired, so rebuild them from their IDs.
+	orphans, err := sm.orphanResources(desiredResources)
+	if err != nil {
+		return err
+	}
+	deleteOrder, err := sm.orphanDeleteOrder(orphans)
+	if err != nil {
+		return err
+	}
+	all := append(append([]Resource{}, desiredResources...), orphans...)
 
-	resourceMap := make(map[string]Resource)
-	for _, res := range desiredResources {
-		resourceMap[res.ID()] = res
+	g, err := buildGraph(all, deleteOrder)
+	if err != nil {
+		return err
+	}
+	if err := sm.checkDestroy(changes, g.nodes); err != nil {
+		return err
 	}
 
+	changesByResource := make(map[string][]Change)
 	for _, change := range changes {
-		log.Info("Applying change", "type", change.Type, "resource_id", change.ResourceID, "details", change.Details, "dry_run", sm.dryRun)
-
-		res, ok := resourceMap[change.ResourceID]
-		if !ok {
+		if _, ok := g.nodes[change.ResourceID]; !ok {
 			log.Error("Resource not found for change", "resource_id", change.ResourceID)
 			continue
 		}
+		changesByResource[change.ResourceID] = append(changesByResource[change.ResourceID], change)
+	}
 
-		if err := res.Apply(sm.dryRun, []Change{change}); err != nil {
-			return fmt.Errorf("failed to apply change for %s: %w", change.ResourceID, err)
+	startedAt := time.Now().UTC()
+	journal := &runJournal{}
+
+	// The run context is also cancelled by the first failure, unless the run
+	// should continue past failures.
+	runCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	results := g.walk(sm.parallelism, func(res Resource) error {
+		err := sm.applyResource(runCtx, res, changesByResource[res.ID()], journal)
+		if err != nil && sm.failureMode != FailureContinue && !errors.Is(err, ErrInterrupted) {
+			abort(fmt.Errorf("%w: %s", errRunAborted, res.ID()))
 		}
+		return err
+	})
 
-		// After applying, read the new current state and save it to BoltDB
-		if !sm.dryRun {
-			log.Info("Updating state in DB for resource", "id", change.ResourceID)
-			updatedState, err := res.ReadCurrentState(sm.dryRun) // Read actual state after apply
-			if err != nil {
-				log.Error("Failed to read updated state after apply", "resource_id", change.ResourceID, "error", err)
-				// Continue, but log the error
+	run := &RunRecord{StartedAt: startedAt, FailureMode: sm.failureMode, Applied: journal.changes()}
+	var errs []error
+	for _, id := range g.order {
+		err := results[id]
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrDependencyFailed):
+			log.Warn("Skipped resource because a dependency did not apply", "resource_id", id, "error", err)
+			run.Skipped = append(run.Skipped, id)
+			errs = append(errs, fmt.Errorf("skipped %s: %w", id, err))
+		case errors.Is(err, ErrInterrupted):
+			log.Warn("Stopped resource", "resource_id", id, "error", err)
+			run.Skipped = append(run.Skipped, id)
+			if ctx.Err() != nil {
+				errs = append(errs, err) // Stopped by the operator rather than by a failure
 			}
-			if updatedState != nil {
-				if err := sm.WriteState(change.ResourceID, updatedState); err != nil {
-					log.Error("Failed to write updated state to DB", "resource_id", change.ResourceID, "error", err)
-					// Continue, but log the error
-				}
+		default:
+			run.Failures = append(run.Failures, RunFailure{ResourceID: id, Stage: "apply", Error: err.Error()})
+			errs = append(errs, err)
+		}
+	}
+
+	switch {
+	case len(run.Failures) > 0 && sm.failureMode == FailureRollback:
+		log.Warn("Rolling back the changes completed in this run...", "changes", len(run.Applied), "dry_run", sm.dryRun)
+		undone, undoFailures := sm.rollback(ctx, journal)
+		run.Undone = undone
+		run.Failures = append(run.Failures, undoFailures...)
+		run.Outcome = RunRolledBack
+		if len(undoFailures) > 0 {
+			run.Outcome = RunRollbackFailed
+			for _, failure := range undoFailures {
+				errs = append(errs, fmt.Errorf("failed to undo change for %s: %s", failure.ResourceID, failure.Error))
 			}
 		}
+		log.Info("Rollback finished.", "undone", len(undone), "not_undone", len(undoFailures))
+	case len(run.Failures) > 0:
+		run.Outcome = RunFailed
+	case ctx.Err() != nil:
+		run.Outcome = RunInterrupted
+	default:
+		run.Outcome = RunSucceeded
+	}
+
+	if !sm.dryRun {
+		run.FinishedAt = time.Now().UTC()
+		if err := sm.recordRun(run); err != nil {
+			log.Error("Failed to record the outcome of the run", "error", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		err := errors.Join(errs...)
+		if run.Outcome == RunRolledBack {
+			return fmt.Errorf("apply failed, %d completed change(s) were rolled back: %w", len(run.Undone), err)
+		}
+		return err
 	}
 
 	log.Info("Changes applied.", "dry_run", sm.dryRun)
 	return nil
 }
+
+// applyResource applies the changes of a single resource and records its new state.
+func (sm *StateManager) applyResource(ctx context.Context, res Resource, changes []Change, journal *runJournal) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %s was not started: %v", ErrInterrupted, res.ID(), context.Cause(ctx))
+	}
+	if len(changes) == 0 {
+		return sm.recordLifecycle(res)
+	}
+
+	// Commands are bounded by the resource timeout but are not killed when ctx
+	// is cancelled: the running step finishes and no further step starts.
+	timeout := resourceTimeout(res)
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var applied []Change
+	for _, change := range changes {
+		if ctx.Err() != nil {
+			sm.recordApplied(ctx, res, applied, "apply (interrupted)")
+			return fmt.Errorf("%w: %s stopped after %d of %d changes: %v", ErrInterrupted, res.ID(), len(applied), len(changes), context.Cause(ctx))
+		}
+		log.Info("Applying change", "type", change.Type, "resource_id", change.ResourceID, "details", change.Details, "dry_run", sm.dryRun)
+		if err := res.Apply(runCtx, sm.dryRun, []Change{change}); err != nil {
+			err = timeoutError(runCtx, timeout, err)
+			if ctx.Err() != nil {
+				// The interrupt also reaches commands running in the foreground.
+				sm.recordApplied(ctx, res, applied, "apply (interrupted)")
+				return fmt.Errorf("%w: %s: %w", ErrInterrupted, change.ResourceID, err)
+			}
+			sm.recordApplied(ctx, res, applied, "apply (partial)")
+			return fmt.Errorf("failed to apply change for %s: %w", change.ResourceID, err)
+		}
+		applied = append(applied, change)
+		journal.add(res, change)
+	}
+
+	if deleted := sm.recordApplied(ctx, res, applied, "apply"); deleted {
+		return nil
+	}
+	return sm.recordLifecycle(res)
+}
+
+// recordApplied records the state a resource was left in after the given
+// changes were applied, or forgets it if it was deleted. It reports whether
+// the resource was deleted. Nothing is recorded in dry-run mode or if no
+// change was applied.
+func (sm *StateManager) recordApplied(ctx context.Context, res Resource, applied []Change, operation string) (deleted bool) {
+	for _, change := range applied {
+		if change.Type == ChangeTypeDelete {
+			deleted = true
+		}
+	}
+	if sm.dryRun || len(applied) == 0 {
+		return deleted
+	}
+
+	if deleted {
+		log.Info("Removing recorded state of deleted resource", "id", res.ID())
+		if err := sm.ForgetState(res.ID(), applied); err != nil {
+			log.Error("Failed to remove recorded state of deleted resource", "resource_id", res.ID(), "error", err)
+		}
+		return deleted
+	}
+
+	// Read the actual state after apply with a context that is not cancelled,
+	// so it is recorded even when the apply was interrupted or timed out.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateReadTimeout)
+	defer cancel()
+
+	log.Info("Updating state in DB for resource", "id", res.ID(), "operation", operation)
+	updatedState, err := res.ReadCurrentState(ctx, sm.dryRun)
+	if err != nil {
+		log.Error("Failed to read updated state after apply", "resource_id", res.ID(), "error", err)
+		// Continue, but log the error
+	}
+	if updatedState != nil {
+		if err := sm.RecordState(res.ID(), protectState(updatedState, sensitiveKeys(res)), operation, applied); err != nil {
+			log.Error("Failed to write updated state to DB", "resource_id", res.ID(), "error", err)
+			// Continue, but log the error
+		}
+	}
+	return deleted
+}
+
+// timeoutError explains err if it was caused by ctx exceeding the resource timeout.
+func timeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package statemanager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table used to compare two texts. Larger
+// inputs are shown as a full replacement instead.
+const maxDiffCells = 4 << 20
+
+// diffLine is a line of a line-based diff: ' ' (unchanged), '-' or '+'.
+type diffLine struct {
+	op   byte
+	text string // Including its newline, if any
+}
+
+// UnifiedDiff returns a unified diff of two texts, in the format of diff -u,
+// or "" if they are equal. It is shown in plans for resources that manage
+// file content.
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk over changes separated by few enough unchanged
+		// lines that their context would overlap.
+		end := i + 1
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		start := max(i-diffContext, 0)
+		stop := min(end+diffContext, len(lines))
+		writeHunk(&b, lines, start, stop)
+		i = stop
+	}
+	return b.String()
+}
+
+// writeHunk writes lines[start:stop] as a hunk with its @@ header.
+func writeHunk(b *strings.Builder, lines []diffLine, start, stop int) {
+	var oldBefore, newBefore, oldCount, newCount int
+	for i, line := range lines[:stop] {
+		inHunk := i >= start
+		if line.op != '+' {
+			if inHunk {
+				oldCount++
+			} else {
+				oldBefore++
+			}
+		}
+		if line.op != '-' {
+			if inHunk {
+				newCount++
+			} else {
+				newBefore++
+			}
+		}
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldBefore, oldCount), hunkRange(newBefore, newCount))
+	for _, line := range lines[start:stop] {
+		b.WriteByte(line.op)
+		b.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start and length of one side of a hunk.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits text into lines, keeping their newlines.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest line-based edit script from a to b using the
+// longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	var lines []diffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, text := range a {
+			lines = append(lines, diffLine{op: '-', text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, diffLine{op: '+', text: text})
+		}
+		return lines
+	}
+
+	// lcs[i*(m+1)+j] is the length of the longest common subsequence of a[i:] and b[j:].
+	n, m := len(a), len(b)
+	lcs := make([]int, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{op: ' ', text: a[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			lines = append(lines, diffLine{op: '-', text: a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, diffLine{op: '-', text: a[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, diffLine{op: '+', text: b[j]})
+	}
+	return lines
+}
@@ -0,0 +1,158 @@
+package statemanager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1 to 20, with the lines in replace changed.
+func numbered(replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= 20; i++ {
+		if text, ok := replace[i]; ok {
+			b.WriteString(text + "\n")
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	return b.String()
+}
+
+// The expected diffs are the output of diff -u --label old --label new.
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{
+			name:    "equal",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			want:    "",
+		},
+		{
+			name:    "changes within twice the context share a hunk",
+			oldText: numbered(nil),
+			newText: numbered(map[int]string{5: "five", 12: "twelve"}),
+			want: `--- old
++++ new
+@@ -2,14 +2,14 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
+ 11
+-12
++twelve
+ 13
+ 14
+ 15
+`,
+		},
+		{
+			name:    "changes further apart get separate hunks",
+			oldText: numbered(nil),
+			newText: numbered(map[int]string{5: "five", 13: "thirteen"}),
+			want: `--- old
++++ new
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -10,7 +10,7 @@
+ 10
+ 11
+ 12
+-13
++thirteen
+ 14
+ 15
+ 16
+`,
+		},
+		{
+			name:    "insert only",
+			oldText: "",
+			newText: "a\nb\n",
+			want: `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			name:    "insert in the middle",
+			oldText: "a\nb\nc\n",
+			newText: "a\nx\ny\nb\nc\n",
+			want: `--- old
++++ new
+@@ -1,3 +1,5 @@
+ a
++x
++y
+ b
+ c
+`,
+		},
+		{
+			name:    "delete only",
+			oldText: "a\nb\n",
+			newText: "",
+			want: `--- old
++++ new
+@@ -1,2 +0,0 @@
+-a
+-b
+`,
+		},
+		{
+			name:    "no trailing newline",
+			oldText: "a\nb",
+			newText: "a\nc",
+			want: `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+		},
+		{
+			name:    "trailing newline added",
+			oldText: "a",
+			newText: "a\n",
+			want: `--- old
++++ new
+@@ -1 +1 @@
+-a
+\ No newline at end of file
++a
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("old", "new", tt.oldText, tt.newText); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
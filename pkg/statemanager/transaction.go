@@ -0,0 +1,156 @@
+package statemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/chalkan3/slothctl/internal/log"
+)
+
+// FailureMode decides what Apply does when a resource fails.
+type FailureMode string
+
+const (
+	// FailureStop starts no further resources once one fails. Changes that
+	// already completed stay applied. This is the default.
+	FailureStop FailureMode = "stop"
+	// FailureContinue applies every resource that does not depend on a failed
+	// one and reports all failures at the end.
+	FailureContinue FailureMode = "continue"
+	// FailureRollback stops like FailureStop, then reverts the changes that
+	// completed in this run, newest first.
+	FailureRollback FailureMode = "rollback"
+)
+
+// ParseFailureMode parses the value of the --on-failure flag.
+func ParseFailureMode(s string) (FailureMode, error) {
+	switch mode := FailureMode(s); mode {
+	case FailureStop, FailureContinue, FailureRollback:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid failure mode %q: must be one of rollback, stop or continue", s)
+}
+
+// ErrUndoUnsupported is returned by Undo for changes a resource cannot revert.
+var ErrUndoUnsupported = errors.New("change cannot be undone")
+
+// errRunAborted is the cause attached to the run context when a failure stops the run.
+var errRunAborted = errors.New("another resource failed")
+
+// Undoable is implemented by resources that can revert the changes they apply.
+// Undo is given a change that Apply completed and returns ErrUndoUnsupported
+// for change types that cannot be reverted.
+type Undoable interface {
+	Undo(ctx context.Context, dryRun bool, change Change) error
+}
+
+// SetFailureMode sets what Apply does when a resource fails.
+func (sm *StateManager) SetFailureMode(mode FailureMode) {
+	sm.failureMode = mode
+}
+
+// appliedChange is a change that completed during a run.
+type appliedChange struct {
+	res    Resource
+	change Change
+}
+
+// runJournal records the changes completed during a run, in completion order,
+// so they can be reverted.
+type runJournal struct {
+	mu      sync.Mutex
+	applied []appliedChange
+}
+
+func (j *runJournal) add(res Resource, change Change) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.applied = append(j.applied, appliedChange{res: res, change: change})
+}
+
+func (j *runJournal) changes() []Change {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changes := make([]Change, 0, len(j.applied))
+	for _, a := range j.applied {
+		changes = append(changes, a.change)
+	}
+	return changes
+}
+
+// rollback reverts the changes in the journal, newest first, and records the
+// resulting state of every resource it touched. It returns the changes that
+// were undone and the failures of those that could not be.
+func (sm *StateManager) rollback(ctx context.Context, journal *runJournal) ([]Change, []RunFailure) {
+	var undone []Change
+	var failures []RunFailure
+	undoneByResource := make(map[string][]Change)
+	var touched []Resource
+
+	// Undo runs even if the apply was interrupted, bounded by each resource's timeout.
+	ctx = context.WithoutCancel(ctx)
+
+	for i := len(journal.applied) - 1; i >= 0; i-- {
+		res, change := journal.applied[i].res, journal.applied[i].change
+		if change.Type == ChangeTypeNoOp {
+			continue
+		}
+
+		undoable, ok := res.(Undoable)
+		if !ok {
+			log.Error("Cannot undo change, resource does not support undo", "type", change.Type, "resource_id", res.ID())
+			failures = append(failures, RunFailure{ResourceID: res.ID(), Stage: "undo", Error: fmt.Sprintf("%s: %v", change.Type, ErrUndoUnsupported)})
+			continue
+		}
+
+		log.Info("Undoing change", "type", change.Type, "resource_id", res.ID(), "dry_run", sm.dryRun)
+		timeout := resourceTimeout(res)
+		undoCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := undoable.Undo(undoCtx, sm.dryRun, change)
+		err = timeoutError(undoCtx, timeout, err)
+		cancel()
+		if err != nil {
+			log.Error("Failed to undo change", "type", change.Type, "resource_id", res.ID(), "error", err)
+			failures = append(failures, RunFailure{ResourceID: res.ID(), Stage: "undo", Error: fmt.Sprintf("%s: %v", change.Type, err)})
+			continue
+		}
+
+		undone = append(undone, change)
+		if _, seen := undoneByResource[res.ID()]; !seen {
+			touched = append(touched, res)
+		}
+		undoneByResource[res.ID()] = append(undoneByResource[res.ID()], change)
+	}
+
+	for _, res := range touched {
+		sm.recordUndone(ctx, res, undoneByResource[res.ID()])
+	}
+	return undone, failures
+}
+
+// recordUndone records the state of a resource after changes were undone.
+func (sm *StateManager) recordUndone(ctx context.Context, res Resource, undone []Change) {
+	if sm.dryRun {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateReadTimeout)
+	defer cancel()
+
+	state, err := res.ReadCurrentState(ctx, sm.dryRun)
+	if err != nil {
+		log.Error("Failed to read state after undo", "resource_id", res.ID(), "error", err)
+		return
+	}
+	if state == nil {
+		if err := sm.ForgetState(res.ID(), undone); err != nil {
+			log.Error("Failed to remove recorded state after undo", "resource_id", res.ID(), "error", err)
+		}
+		return
+	}
+	if err := sm.RecordState(res.ID(), protectState(state, sensitiveKeys(res)), "undo", undone); err != nil {
+		log.Error("Failed to write state after undo", "resource_id", res.ID(), "error", err)
+	}
+}
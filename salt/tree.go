@@ -0,0 +1,10 @@
+// Package salt embeds the Salt states and pillar of the control plane, so
+// that bootstrap can install them on the master.
+package salt
+
+import "embed"
+
+// Tree holds top.sls, formula/ and pillar/, with paths relative to salt/.
+//
+//go:embed top.sls all:formula all:pillar
+var Tree embed.FS
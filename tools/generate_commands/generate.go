@@ -18,6 +18,12 @@ const (
 	outputFile  = "zz_generated_commands.go"
 )
 
+// unregisteredPackages are command packages that are deliberately left out of
+// the CLI even though they register commands.
+var unregisteredPackages = map[string]bool{
+	"pkg/commands/saltnode": true,
+}
+
 func main() {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -83,6 +89,9 @@ func findCommandPackages(dir string, projectRoot string) ([]string, error) {
 										log.Printf("Error getting relative path for %s: %v", path, err)
 										return false
 									}
+									if unregisteredPackages[filepath.ToSlash(relPath)] {
+										return false
+									}
 									if _, exists := uniquePackages[relPath]; !exists {
 										uniquePackages[relPath] = true
 										packages = append(packages, relPath)
@@ -4,10 +4,15 @@
 package zz_generated_commands
 
 import (
+	_ "github.com/chalkan3/slothctl/pkg/commands/apply"
 	_ "github.com/chalkan3/slothctl/pkg/commands/background"
 	_ "github.com/chalkan3/slothctl/pkg/commands/configure"
+	_ "github.com/chalkan3/slothctl/pkg/commands/drift"
 	_ "github.com/chalkan3/slothctl/pkg/commands/glpi"
 	_ "github.com/chalkan3/slothctl/pkg/commands/glpi/tickets"
+	_ "github.com/chalkan3/slothctl/pkg/commands/plan"
 	_ "github.com/chalkan3/slothctl/pkg/commands/server"
+	_ "github.com/chalkan3/slothctl/pkg/commands/state"
+	_ "github.com/chalkan3/slothctl/pkg/commands/vaultcmd"
 	_ "github.com/chalkan3/slothctl/pkg/commands/vpn"
 )